@@ -46,6 +46,27 @@ func BenchmarkLogFaster(b *testing.B) {
 	})
 }
 
+// BenchmarkConsoleEncoder 统计控制台编码的开销，时间、级别与内容直接追加到池化的缓冲中，没有内存分配
+func BenchmarkConsoleEncoder(b *testing.B) {
+	caolog.InitLogger(caolog.InfoLevel)
+	logger := caolog.GetLogger().Logger
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Info(s)
+		}
+	})
+}
+
+// BenchmarkFormatMap 不带 log 标签的 map[string]interface{} 只做一次预检查，仍然由 sonic 一次编码
+func BenchmarkFormatMap(b *testing.B) {
+	v := map[string]interface{}{"id": 1, "name": "cao", "tags": []interface{}{"a", "b"}, "nested": map[string]interface{}{"x": 1.5}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = caolog.FormatBufferPool(v)
+	}
+}
+
 func BenchmarkAll(b *testing.B) {
 	//_ = make([]byte, 1<<32)
 	runtime.GOMAXPROCS(2)
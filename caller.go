@@ -0,0 +1,213 @@
+package caolog
+
+import (
+	"github.com/CaoStudio/caolog/internal/callers"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// AutoDeep 作为 deep 传入时自动查找调用位置：跳过 caolog 自身、runtime、
+// RegisterHelperPackage 注册的包以及调用过 Helper 的函数，取第一个剩下的栈帧
+const AutoDeep = 0
+
+// autoFrame 一个 pc 展开内联之后的结果，skip 为 true 时其中的栈帧都需要跳过
+type autoFrame struct {
+	path string
+	skip bool
+}
+
+var (
+	// callerDisabled 为 true 时不再获取调用位置，Path 为空
+	callerDisabled atomic.Bool
+	// callerCache 调用位置的 pc 到 "目录/文件:行号" 的缓存
+	callerCache cowMap[uintptr, string]
+	// autoCache AutoDeep 使用的缓存，跳过规则变化时清空
+	autoCache cowMap[uintptr, autoFrame]
+	// helperPackages 自动查找调用位置时跳过的包
+	helperPackages = newCowMap(packageSet(callers.Packages))
+	// helperFuncs 调用过 Helper 的函数，helperPCs 是对应的调用位置，用于快速判断是否已经登记
+	helperFuncs cowMap[string, struct{}]
+	helperPCs   cowMap[uintptr, struct{}]
+)
+
+// cowMap 写时复制的并发 map，读取不加锁；只用于很少写入的场景，如调用位置首次出现
+type cowMap[K comparable, V any] struct {
+	mu sync.Mutex
+	m  atomic.Pointer[map[K]V]
+	// generation 每次 reset 加一，避免按旧规则计算的结果在 reset 之后写入
+	generation atomic.Uint64
+}
+
+func packageSet(pkgs []string) map[string]struct{} {
+	m := make(map[string]struct{}, len(pkgs))
+	for _, pkg := range pkgs {
+		m[pkg] = struct{}{}
+	}
+	return m
+}
+
+func newCowMap[K comparable, V any](m map[K]V) *cowMap[K, V] {
+	c := &cowMap[K, V]{}
+	c.m.Store(&m)
+	return c
+}
+
+func (c *cowMap[K, V]) load(key K) (V, bool) {
+	if m := c.m.Load(); m != nil {
+		v, ok := (*m)[key]
+		return v, ok
+	}
+	var zero V
+	return zero, false
+}
+
+func (c *cowMap[K, V]) empty() bool {
+	m := c.m.Load()
+	return m == nil || len(*m) == 0
+}
+
+func (c *cowMap[K, V]) store(key K, value V) {
+	c.storeAt(c.generation.Load(), key, value)
+}
+
+// storeAt 只在 generation 没有变化时写入
+func (c *cowMap[K, V]) storeAt(generation uint64, key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation.Load() != generation {
+		return
+	}
+	m := make(map[K]V)
+	if old := c.m.Load(); old != nil {
+		for k, v := range *old {
+			m[k] = v
+		}
+	}
+	m[key] = value
+	c.m.Store(&m)
+}
+
+func (c *cowMap[K, V]) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation.Add(1)
+	c.m.Store(nil)
+}
+
+// EnableCaller 开启或关闭调用位置的获取，默认开启；关闭后日志不再输出 Path
+func EnableCaller(enable bool) {
+	callerDisabled.Store(!enable)
+}
+
+// CallerEnabled 返回是否获取调用位置
+func CallerEnabled() bool {
+	return !callerDisabled.Load()
+}
+
+// Helper 将调用它的函数标记为日志包装函数，与 testing.T.Helper 类似，
+// 使用 AutoDeep 时输出的调用位置会跳过该函数，指向包装函数的调用者
+func Helper() {
+	var pcs [1]uintptr
+	// 跳过 runtime.Callers 与 Helper
+	if runtime.Callers(2, pcs[:]) == 0 {
+		return
+	}
+	if _, ok := helperPCs.load(pcs[0]); ok {
+		return
+	}
+	frame, _ := runtime.CallersFrames(pcs[:]).Next()
+	helperFuncs.store(frame.Function, struct{}{})
+	helperPCs.store(pcs[0], struct{}{})
+	autoCache.reset()
+}
+
+// RegisterHelperPackage 使用 AutoDeep 时跳过 pkgs 中的包，如对 caolog 再次封装的日志库，
+// pkg 为完整的导入路径
+func RegisterHelperPackage(pkgs ...string) {
+	for _, pkg := range pkgs {
+		helperPackages.store(pkg, struct{}{})
+	}
+	autoCache.reset()
+}
+
+// callerPath 返回 "目录/文件:行号"，deep 从 makeDetails 开始计数，AutoDeep 时自动查找
+func callerPath(deep int) string {
+	if callerDisabled.Load() {
+		return ""
+	}
+	// 跳过 runtime.Callers 与 callerPath
+	if deep == AutoDeep {
+		return autoCallerPath(2)
+	}
+	var pcs [1]uintptr
+	if runtime.Callers(deep+2, pcs[:]) == 0 {
+		return "???:0"
+	}
+	pc := pcs[0]
+	if path, ok := callerCache.load(pc); ok {
+		return path
+	}
+	// pc 是返回地址，减一后落在调用指令上
+	file, line := "???", 0
+	if fn := runtime.FuncForPC(pc - 1); fn != nil {
+		file, line = fn.FileLine(pc - 1)
+	}
+	path := formatPath(file, line)
+	callerCache.store(pc, path)
+	return path
+}
+
+// autoCallerPath 从第 skip 层开始查找第一个不需要跳过的栈帧
+func autoCallerPath(skip int) string {
+	var pcs [16]uintptr
+	for {
+		n := runtime.Callers(skip+1, pcs[:])
+		for _, pc := range pcs[:n] {
+			frame, ok := autoCache.load(pc)
+			if !ok {
+				frame = resolveAutoFrame(pc)
+			}
+			if !frame.skip {
+				return frame.path
+			}
+		}
+		if n < len(pcs) {
+			return "???:0"
+		}
+		// 一个 pc 至少对应一层栈帧，重复检查的栈帧都会被跳过
+		skip += n
+	}
+}
+
+// resolveAutoFrame 展开 pc 中的内联函数，由内向外取第一个不需要跳过的栈帧
+func resolveAutoFrame(pc uintptr) autoFrame {
+	generation := autoCache.generation.Load()
+	result := autoFrame{skip: true}
+	frames := runtime.CallersFrames([]uintptr{pc})
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "" && !skipFunction(frame.Function) {
+			result = autoFrame{path: formatPath(frame.File, frame.Line)}
+			break
+		}
+		if !more {
+			break
+		}
+	}
+	autoCache.storeAt(generation, pc, result)
+	return result
+}
+
+func skipFunction(function string) bool {
+	if _, ok := helperPackages.load(callers.FuncPackage(function)); ok {
+		return true
+	}
+	_, ok := helperFuncs.load(function)
+	return ok
+}
+
+func formatPath(file string, line int) string {
+	return file[PenultimateIndexByteString(file, '/')+1:] + ":" + strconv.Itoa(line)
+}
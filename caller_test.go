@@ -0,0 +1,57 @@
+package caolog_test
+
+import (
+	"bytes"
+	"context"
+	caolog "github.com/CaoStudio/caolog"
+	"github.com/CaoStudio/caolog/internal/caologtest"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func logWrapper(logger *caolog.Logger, args ...interface{}) {
+	caolog.Helper()
+	logger.CInfo(context.Background(), caolog.AutoDeep, args...)
+}
+
+func TestAutoDeep(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := caologtest.NewBufferLogger(buf)
+
+	logger.CInfo(context.Background(), caolog.AutoDeep, "direct")
+	_, _, line, _ := runtime.Caller(0)
+	logWrapper(logger, "wrapped")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", lines)
+	}
+	if want := "caller_test.go:" + strconv.Itoa(line-1) + " "; !strings.Contains(lines[0], want) {
+		t.Fatalf("direct call should log %q, got %q", want, lines[0])
+	}
+	if want := "caller_test.go:" + strconv.Itoa(line+1) + " "; !strings.Contains(lines[1], want) {
+		t.Fatalf("helper should be skipped and log %q, got %q", want, lines[1])
+	}
+}
+
+func TestCallerCache(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := caologtest.NewBufferLogger(buf)
+
+	for range 2 {
+		logger.CInfo(context.Background(), 3, "cached")
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "caller_test.go:") || strings.TrimSpace(lines[0]) != lines[1] {
+		t.Fatalf("same call site should log the same path, got %q", lines)
+	}
+
+	defer caolog.EnableCaller(true)
+	caolog.EnableCaller(false)
+	buf.Reset()
+	logger.CInfo(context.Background(), 3, "no caller")
+	if strings.Contains(buf.String(), "caller_test.go") {
+		t.Fatalf("caller should be disabled, got %q", buf.String())
+	}
+}
@@ -0,0 +1,81 @@
+package caolog
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	canonicalKey struct{}
+
+	// Canonical 请求级的字段累加器，请求结束时输出一行包含全部字段、耗时与结果的日志
+	Canonical struct {
+		mu      sync.Mutex
+		start   time.Time
+		keyvals []interface{}
+	}
+)
+
+// StartCanonical 在 ctx 中创建累加器，通常由中间件在请求开始时调用
+func StartCanonical(ctx context.Context) (context.Context, *Canonical) {
+	c := &Canonical{start: time.Now()}
+	return context.WithValue(ctx, canonicalKey{}, c), c
+}
+
+// CanonicalFromContext 返回 ctx 中的累加器
+func CanonicalFromContext(ctx context.Context) (*Canonical, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	c, ok := ctx.Value(canonicalKey{}).(*Canonical)
+	return c, ok
+}
+
+// Annotate 向 ctx 中的累加器添加字段，同名字段以最后一次为准；ctx 中没有累加器时忽略
+func Annotate(ctx context.Context, key string, value interface{}) {
+	if c, ok := CanonicalFromContext(ctx); ok {
+		c.Annotate(key, value)
+	}
+}
+
+// Annotate 添加字段，同名字段以最后一次为准
+func (c *Canonical) Annotate(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := 0; i < len(c.keyvals); i += 2 {
+		if c.keyvals[i] == key {
+			c.keyvals[i+1] = value
+			return
+		}
+	}
+	c.keyvals = append(c.keyvals, key, value)
+}
+
+// Keyvals 返回交替的 key、value，末尾追加 duration、outcome，err 不为 nil 时追加 error
+func (c *Canonical) Keyvals(err error) []interface{} {
+	c.mu.Lock()
+	keyvals := make([]interface{}, len(c.keyvals), len(c.keyvals)+6)
+	copy(keyvals, c.keyvals)
+	c.mu.Unlock()
+
+	keyvals = append(keyvals, "duration", time.Since(c.start).String())
+	if err != nil {
+		return append(keyvals, "outcome", "error", "error", err.Error())
+	}
+	return append(keyvals, "outcome", "ok")
+}
+
+// Finish 使用 ctx 中的 logger 输出汇总日志，err 不为 nil 时为 error 级别
+func (c *Canonical) Finish(ctx context.Context, err error, args ...interface{}) {
+	l := FromContext(ctx)
+	keyvals := c.Keyvals(err)
+	for i := 0; i < len(keyvals); i += 2 {
+		args = append(args, Any(keyvals[i].(string), keyvals[i+1]))
+	}
+	if err != nil {
+		l.CError(ctx, AutoDeep, args...)
+		return
+	}
+	l.CInfo(ctx, AutoDeep, args...)
+}
@@ -5,32 +5,30 @@ type CommonLogger struct {
 	Logger
 }
 
-var commonDeep = 3
-
 // NewCommonLogger 创建一个通用日志对象
 func NewCommonLogger(logger *Logger) CommonLogger {
 	return CommonLogger{*logger}
 }
 
 func (l CommonLogger) Debug(args ...interface{}) {
-	l.Logger.Debug(commonDeep, args...)
+	l.Logger.Debug(AutoDeep, args...)
 }
 func (l CommonLogger) Info(args ...interface{}) {
-	l.Logger.Info(commonDeep, args...)
+	l.Logger.Info(AutoDeep, args...)
 }
 func (l CommonLogger) Warn(args ...interface{}) {
-	l.Logger.Warn(commonDeep, args...)
+	l.Logger.Warn(AutoDeep, args...)
 }
 func (l CommonLogger) Error(args ...interface{}) {
 	// 预留错误处理
-	l.Logger.Error(commonDeep, args...)
+	l.Logger.Error(AutoDeep, args...)
 }
 func (l CommonLogger) DPanic(args ...interface{}) {
-	l.Logger.DPanic(commonDeep, args...)
+	l.Logger.DPanic(AutoDeep, args...)
 }
 func (l CommonLogger) Panic(args ...interface{}) {
-	l.Logger.Panic(commonDeep, args...)
+	l.Logger.Panic(AutoDeep, args...)
 }
 func (l CommonLogger) Fatal(args ...interface{}) {
-	l.Logger.Fatal(commonDeep, args...)
+	l.Logger.Fatal(AutoDeep, args...)
 }
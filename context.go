@@ -0,0 +1,81 @@
+package caolog
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+)
+
+type (
+	fieldsKey struct{}
+	loggerKey struct{}
+)
+
+// WithFields 返回携带字段的 ctx，使用该 ctx 的日志都会输出这些字段
+// args 为交替的 key、value，也可以直接传入 zap.Field
+func WithFields(ctx context.Context, args ...interface{}) context.Context {
+	if len(args) == 0 {
+		return ctx
+	}
+	parent := FieldsFromContext(ctx)
+	fields := make([]zap.Field, len(parent), len(parent)+len(args))
+	copy(fields, parent)
+	return context.WithValue(ctx, fieldsKey{}, appendKeyvals(fields, args))
+}
+
+// appendKeyvals 将交替的 key、value 或 zap.Field 转换为字段追加到 fields
+func appendKeyvals(fields []zap.Field, args []interface{}) []zap.Field {
+	for i := 0; i < len(args); i++ {
+		if field, ok := args[i].(zap.Field); ok {
+			fields = append(fields, field)
+			continue
+		}
+		key, ok := args[i].(string)
+		if !ok {
+			key = fmt.Sprint(args[i])
+		}
+		if i+1 < len(args) {
+			fields = append(fields, Any(key, args[i+1]))
+			i++
+		} else {
+			fields = append(fields, zap.String(key, "KEYVALS UNPAIRED"))
+		}
+	}
+	return fields
+}
+
+// FieldsFromContext 返回 WithFields 添加到 ctx 中的字段，调用方不能修改
+func FieldsFromContext(ctx context.Context) []zap.Field {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).([]zap.Field)
+	return fields
+}
+
+// ContextFields 内置 Option，将 WithFields 添加的字段追加到日志中
+func ContextFields(ctx context.Context, details *Details) {
+	details.Fields = append(details.Fields, FieldsFromContext(ctx)...)
+}
+
+// NewContext 返回携带 logger 的 ctx，包级的 CInfo 等函数会优先使用它
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext 返回 NewContext 放入 ctx 的 logger，没有时返回全局 logger
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := LoggerFromContext(ctx); ok {
+		return l
+	}
+	return logger
+}
+
+// LoggerFromContext 返回 NewContext 放入 ctx 的 logger，ok 表示 ctx 中是否有 logger
+func LoggerFromContext(ctx context.Context) (*Logger, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	l, ok := ctx.Value(loggerKey{}).(*Logger)
+	return l, ok
+}
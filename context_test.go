@@ -0,0 +1,72 @@
+package caolog_test
+
+import (
+	"bytes"
+	"context"
+	caolog "github.com/CaoStudio/caolog"
+	"github.com/CaoStudio/caolog/internal/caologtest"
+	"go.uber.org/zap"
+	"strings"
+	"testing"
+)
+
+func TestWithFields(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := caologtest.NewBufferLogger(buf)
+	logger.Options = []caolog.Option{caolog.ContextFields}
+
+	ctx := caolog.WithFields(context.Background(), "order_id", 42)
+	child := caolog.WithFields(ctx, zap.String("user", "cao"), "dangling")
+	logger.CInfo(child, 2, "paid")
+	if !strings.Contains(buf.String(), `{"order_id": 42, "user": "cao", "dangling": "KEYVALS UNPAIRED"}`) {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+
+	buf.Reset()
+	logger.CInfo(ctx, 2, "created")
+	if strings.Contains(buf.String(), "user") {
+		t.Fatalf("child fields leaked to the parent ctx: %q", buf.String())
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if caolog.FromContext(context.Background()) != caolog.GetLogger() {
+		t.Fatalf("expected the global logger without a ctx logger")
+	}
+	if _, ok := caolog.LoggerFromContext(context.Background()); ok {
+		t.Fatalf("LoggerFromContext should report a missing ctx logger")
+	}
+
+	buf := &bytes.Buffer{}
+	tagged := false
+	logger := caologtest.NewBufferLogger(buf).Child(func(ctx context.Context, details *caolog.Details) {
+		tagged = true
+	})
+	ctx := caolog.NewContext(context.Background(), logger)
+	if l, ok := caolog.LoggerFromContext(ctx); !ok || l != logger {
+		t.Fatalf("LoggerFromContext should return the ctx logger")
+	}
+	caolog.CInfo(ctx, "scoped")
+	if !tagged || !strings.Contains(buf.String(), "scoped") {
+		t.Fatalf("package functions should use the ctx logger, got %q", buf.String())
+	}
+	if caolog.FromContext(ctx).Named("repo").Name() != "repo" {
+		t.Fatalf("named child of the ctx logger")
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ctx, canonical := caolog.StartCanonical(caolog.NewContext(context.Background(), caologtest.NewBufferLogger(buf)))
+	caolog.Annotate(ctx, "cache_hit", false)
+	caolog.Annotate(ctx, "cache_hit", true)
+	caolog.Annotate(ctx, "rows", 3)
+	canonical.Finish(ctx, nil, "[Request]")
+
+	out := buf.String()
+	if strings.Count(out, "\n") != 1 || !strings.Contains(out, `"cache_hit": true, "rows": 3, "duration": `) || !strings.Contains(out, `"outcome": "ok"`) {
+		t.Fatalf("unexpected canonical line %q", out)
+	}
+
+	caolog.Annotate(context.Background(), "ignored", true)
+}
@@ -0,0 +1,69 @@
+package caolog
+
+import (
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+const consoleTimeLayout = "[2006-01-02 - 15:04:05]"
+
+var consolePool = buffer.NewPool()
+
+// consoleEncoder 与 zap 的 console 格式相同，但时间与级别直接追加到缓冲中，不产生内存分配
+type consoleEncoder struct {
+	// 编码字段与 With 添加的上下文，不输出时间、级别等条目信息
+	zapcore.Encoder
+	layout     string
+	lineEnding string
+}
+
+func newConsoleEncoder(layout string) zapcore.Encoder {
+	return &consoleEncoder{
+		Encoder: zapcore.NewJSONEncoder(zapcore.EncoderConfig{
+			EncodeDuration: zapcore.SecondsDurationEncoder,
+			EncodeTime:     zapcore.TimeEncoderOfLayout(layout),
+			SkipLineEnding: true,
+		}),
+		layout:     layout,
+		lineEnding: zapcore.DefaultLineEnding,
+	}
+}
+
+func (c *consoleEncoder) Clone() zapcore.Encoder {
+	clone := *c
+	clone.Encoder = c.Encoder.Clone()
+	return &clone
+}
+
+// EncodeEntry 输出 "时间\t[级别]\t名称\t内容\t{字段}"，没有名称或字段时省略
+func (c *consoleEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	line := consolePool.Get()
+	line.AppendTime(ent.Time, c.layout)
+	line.AppendString("\t[")
+	line.AppendString(ent.Level.CapitalString())
+	line.AppendByte(']')
+	if ent.LoggerName != "" {
+		line.AppendByte('\t')
+		line.AppendString(ent.LoggerName)
+	}
+	line.AppendByte('\t')
+	line.AppendString(ent.Message)
+
+	context, err := c.Encoder.EncodeEntry(zapcore.Entry{}, fields)
+	if err != nil {
+		line.Free()
+		return nil, err
+	}
+	if context.Len() > 2 {
+		line.AppendByte('\t')
+		line.AppendBytes(context.Bytes())
+	}
+	context.Free()
+
+	if ent.Stack != "" {
+		line.AppendByte('\n')
+		line.AppendString(ent.Stack)
+	}
+	line.AppendString(c.lineEnding)
+	return line, nil
+}
@@ -0,0 +1,23 @@
+// Package callers 解析栈帧中的函数名，供 caolog 查找调用位置与 plugin 裁剪 panic 调用栈共用
+package callers
+
+import (
+	"strings"
+)
+
+// Packages 是 runtime 与 caolog 自身的包，这些包中的栈帧不属于调用者
+var Packages = []string{
+	"runtime",
+	"github.com/CaoStudio/caolog",
+	"github.com/CaoStudio/caolog/plugin",
+	"github.com/CaoStudio/caolog/kratos_log",
+}
+
+// FuncPackage 从完整函数名中取出包路径，如 github.com/a/b.(*T).M 返回 github.com/a/b
+func FuncPackage(function string) string {
+	slash := strings.LastIndexByte(function, '/')
+	if dot := strings.IndexByte(function[slash+1:], '.'); dot >= 0 {
+		return function[:slash+1+dot]
+	}
+	return function
+}
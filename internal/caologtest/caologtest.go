@@ -0,0 +1,26 @@
+// Package caologtest 提供测试使用的 logger，日志写入内存中的缓冲以便断言输出
+package caologtest
+
+import (
+	"bytes"
+	caolog "github.com/CaoStudio/caolog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewBufferLogger 返回写入 buf 的 logger，core 接受所有级别
+func NewBufferLogger(buf *bytes.Buffer) *caolog.Logger {
+	return NewBufferLoggerAt(buf, zapcore.DebugLevel)
+}
+
+// NewBufferLoggerAt 返回写入 buf 的 logger，core 只接受 level 及以上的级别
+func NewBufferLoggerAt(buf *bytes.Buffer, level zapcore.Level) *caolog.Logger {
+	encoder := zapcore.NewConsoleEncoder(zapcore.EncoderConfig{
+		LevelKey:    "level",
+		MessageKey:  "msg",
+		EncodeLevel: zapcore.CapitalLevelEncoder,
+	})
+	return &caolog.Logger{
+		Logger: zap.New(zapcore.NewCore(encoder, zapcore.AddSync(buf), level)),
+	}
+}
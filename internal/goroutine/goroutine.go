@@ -0,0 +1,21 @@
+// Package goroutine 获取当前 goroutine 的编号，供飞行记录与 panic 报告共用
+package goroutine
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+)
+
+// ID 解析 runtime.Stack 的首行 "goroutine 123 [running]:"，每次调用都会获取一次调用栈，
+// 不要在热路径上使用
+func ID() uint64 {
+	var buf [64]byte
+	stack := buf[:runtime.Stack(buf[:], false)]
+	stack = bytes.TrimPrefix(stack, []byte("goroutine "))
+	if i := bytes.IndexByte(stack, ' '); i >= 0 {
+		stack = stack[:i]
+	}
+	id, _ := strconv.ParseUint(string(stack), 10, 64)
+	return id
+}
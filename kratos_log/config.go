@@ -0,0 +1,79 @@
+package kratoslog
+
+import (
+	"github.com/CaoStudio/caolog"
+	"github.com/CaoStudio/caolog/plugin"
+	"github.com/go-kratos/kratos/v2/config"
+	"go.uber.org/zap/zapcore"
+)
+
+// LogConfig is the logging settings bound by BindConfig, for example:
+//
+//	log:
+//	  level: info
+//	  levels:
+//	    order.repo: debug
+//	  sample_rate: 0.1
+type LogConfig struct {
+	// Level is the global level, empty keeps the current one.
+	Level string `json:"level"`
+	// Levels are the levels of named loggers, see caolog.Logger.Named.
+	Levels map[string]string `json:"levels"`
+	// SampleRate is the rate of the sampler, nil keeps the current one.
+	SampleRate *float64 `json:"sample_rate"`
+	// SampledFlag uses the otel sampled flag instead of the sample rate.
+	SampledFlag bool `json:"sampled_flag"`
+}
+
+// BindConfig applies the LogConfig under key and watches it for updates, sampler may be nil.
+func BindConfig(c config.Config, key string, sampler *plugin.Sampler) error {
+	var conf LogConfig
+	if err := c.Value(key).Scan(&conf); err != nil {
+		return err
+	}
+	if err := conf.apply(sampler); err != nil {
+		return err
+	}
+	return c.Watch(key, func(key string, value config.Value) {
+		var conf LogConfig
+		if err := value.Scan(&conf); err != nil {
+			caolog.Error("[Kratos] scan log config failed", key, err)
+			return
+		}
+		if err := conf.apply(sampler); err != nil {
+			caolog.Error("[Kratos] apply log config failed", key, err)
+			return
+		}
+		caolog.Info("[Kratos] log config updated", key)
+	})
+}
+
+// apply validates all settings before changing any of them
+func (c *LogConfig) apply(sampler *plugin.Sampler) error {
+	level := caolog.GetLevel()
+	if c.Level != "" {
+		var err error
+		if level, err = zapcore.ParseLevel(c.Level); err != nil {
+			return err
+		}
+	}
+	levels := make(map[string]zapcore.Level, len(c.Levels))
+	for name, text := range c.Levels {
+		named, err := zapcore.ParseLevel(text)
+		if err != nil {
+			return err
+		}
+		levels[name] = named
+	}
+
+	// 配置更新时日志仍在输出，使用并发安全的 AtomicLevel
+	caolog.AtomicLevel().SetLevel(level)
+	caolog.SetNamedLevels(levels)
+	if sampler != nil {
+		if c.SampleRate != nil {
+			sampler.SetRate(*c.SampleRate)
+		}
+		sampler.WithSampledFlag(c.SampledFlag)
+	}
+	return nil
+}
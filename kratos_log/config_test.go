@@ -0,0 +1,60 @@
+package kratoslog_test
+
+import (
+	"bytes"
+	"context"
+	caolog "github.com/CaoStudio/caolog"
+	"github.com/CaoStudio/caolog/internal/caologtest"
+	kratoslog "github.com/CaoStudio/caolog/kratos_log"
+	"github.com/CaoStudio/caolog/plugin"
+	"github.com/go-kratos/kratos/v2/config"
+	"github.com/go-kratos/kratos/v2/config/file"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBindConfig(t *testing.T) {
+	defer caolog.AtomicLevel().SetLevel(caolog.GetLevel())
+	defer caolog.SetNamedLevels(nil)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("log:\n  level: warn\n  sample_rate: 0.5\n")
+
+	c := config.New(config.WithSource(file.NewSource(path)))
+	defer c.Close()
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	sampler := plugin.NewSampler(1)
+	if err := kratoslog.BindConfig(c, "log", sampler); err != nil {
+		t.Fatal(err)
+	}
+	if caolog.GetLevel() != caolog.WarnLevel || sampler.Rate() != 0.5 {
+		t.Fatalf("config not applied: level %s rate %v", caolog.GetLevel(), sampler.Rate())
+	}
+
+	write("log:\n  level: error\n  levels:\n    order: debug\n  sample_rate: 0.25\n")
+	deadline := time.Now().Add(5 * time.Second)
+	for caolog.GetLevel() != caolog.ErrorLevel || sampler.Rate() != 0.25 {
+		if time.Now().After(deadline) {
+			t.Fatalf("config update not applied: level %s rate %v", caolog.GetLevel(), sampler.Rate())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	buf := &bytes.Buffer{}
+	logger := caologtest.NewBufferLogger(buf)
+	logger.Named("order").CDebug(context.Background(), caolog.AutoDeep, "order debug")
+	logger.Named("user").CDebug(context.Background(), caolog.AutoDeep, "user debug")
+	if out := buf.String(); !strings.Contains(out, "order debug") || strings.Contains(out, "user debug") {
+		t.Fatalf("named level from config not applied: %q", out)
+	}
+}
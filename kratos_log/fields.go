@@ -0,0 +1,142 @@
+package kratoslog
+
+import (
+	"context"
+	kratoslog "github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/proto"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field is an optional field of the KratosServer access line.
+type Field int
+
+const (
+	// FieldClientIP is the ip of the caller, X-Forwarded-For and X-Real-IP are preferred.
+	FieldClientIP Field = iota
+	// FieldUserAgent is the User-Agent header.
+	FieldUserAgent
+	// FieldRequestSize is the size of the request in bytes.
+	FieldRequestSize
+	// FieldReplySize is the size of the reply in bytes.
+	FieldReplySize
+	// FieldTraceID is the otel trace id.
+	FieldTraceID
+)
+
+// CodeLevelFunc maps the kratos error code to the level of the access line.
+type CodeLevelFunc func(code int32) kratoslog.Level
+
+// HTTPCodeLevel logs 4xx errors at warn and the others at error.
+func HTTPCodeLevel(code int32) kratoslog.Level {
+	if code >= 400 && code < 500 {
+		return kratoslog.LevelWarn
+	}
+	return kratoslog.LevelError
+}
+
+// WithFields appends the given fields to the access line.
+func WithFields(fields ...Field) ServerOption {
+	return func(o *serverOptions) {
+		o.fields = append(o.fields, fields...)
+	}
+}
+
+// WithMetadataKeys appends the values of the given request header or metadata keys to the access line.
+func WithMetadataKeys(keys ...string) ServerOption {
+	return func(o *serverOptions) {
+		o.metadataKeys = append(o.metadataKeys, keys...)
+	}
+}
+
+// WithSlowThreshold logs successful requests lasting at least d at warn level.
+func WithSlowThreshold(d time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.slow = d
+	}
+}
+
+// WithCodeLevel maps error codes to levels instead of logging every error at error level.
+func WithCodeLevel(fn CodeLevelFunc) ServerOption {
+	return func(o *serverOptions) {
+		o.codeLevel = fn
+	}
+}
+
+// extractFields returns the configured fields as key=value
+func (o *serverOptions) extractFields(ctx context.Context, req, reply interface{}) []string {
+	if len(o.fields) == 0 && len(o.metadataKeys) == 0 {
+		return nil
+	}
+	tr, _ := transport.FromServerContext(ctx)
+	extra := make([]string, 0, len(o.fields)+len(o.metadataKeys))
+	for _, field := range o.fields {
+		switch field {
+		case FieldClientIP:
+			extra = append(extra, "ip="+extractClientIP(ctx, tr))
+		case FieldUserAgent:
+			if tr != nil {
+				extra = append(extra, "ua="+tr.RequestHeader().Get("User-Agent"))
+			}
+		case FieldRequestSize:
+			extra = append(extra, "req_size="+strconv.Itoa(extractSize(req)))
+		case FieldReplySize:
+			extra = append(extra, "reply_size="+strconv.Itoa(extractSize(reply)))
+		case FieldTraceID:
+			extra = append(extra, "trace_id="+extractTraceID(ctx))
+		}
+	}
+	if tr != nil {
+		for _, key := range o.metadataKeys {
+			extra = append(extra, key+"="+tr.RequestHeader().Get(key))
+		}
+	}
+	return extra
+}
+
+// extractClientIP returns the ip of the caller
+func extractClientIP(ctx context.Context, tr transport.Transporter) string {
+	if tr != nil {
+		if ip, _, _ := strings.Cut(tr.RequestHeader().Get("X-Forwarded-For"), ","); ip != "" {
+			return strings.TrimSpace(ip)
+		}
+		if ip := tr.RequestHeader().Get("X-Real-IP"); ip != "" {
+			return ip
+		}
+		if ht, ok := tr.(interface{ Request() *http.Request }); ok {
+			return hostOf(ht.Request().RemoteAddr)
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return hostOf(p.Addr.String())
+	}
+	return ""
+}
+
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// extractSize returns the size of the payload in bytes, -1 if unknown
+func extractSize(payload interface{}) int {
+	switch v := payload.(type) {
+	case nil:
+		return 0
+	case proto.Message:
+		return proto.Size(v)
+	case []byte:
+		return len(v)
+	case string:
+		return len(v)
+	default:
+		return -1
+	}
+}
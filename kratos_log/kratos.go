@@ -8,6 +8,7 @@ import (
 	kratoslog "github.com/go-kratos/kratos/v2/log"
 	"github.com/go-kratos/kratos/v2/middleware"
 	"github.com/go-kratos/kratos/v2/transport"
+	"go.opentelemetry.io/otel/trace"
 	"time"
 )
 
@@ -22,26 +23,87 @@ func NewKratosLogger(logger *caolog.Logger) kratoslog.Logger {
 	}
 }
 
-var kratosDeep = 4
+// kratosLogPackage 是 log.With、log.Helper 等包装层所在的包，输出调用位置时跳过
+const kratosLogPackage = "github.com/go-kratos/kratos/v2/log"
 
-func (l Logger) Log(level kratoslog.Level, msg ...interface{}) error {
+func init() {
+	caolog.RegisterHelperPackage(kratosLogPackage)
+}
+
+// contextLogger is implemented by loggers able to log with the request ctx, such as Logger.
+type contextLogger interface {
+	LogContext(ctx context.Context, level kratoslog.Level, keyvals ...interface{}) error
+}
+
+// Log parses keyvals into fields, the value of the "msg" key is the message.
+func (l Logger) Log(level kratoslog.Level, keyvals ...interface{}) error {
+	return l.LogContext(context.Background(), level, keyvals...)
+}
+
+// LogContext is Log with the request ctx: the logger of caolog.NewContext is preferred,
+// and the fields, request level and trace of ctx apply through the logger options.
+func (l Logger) LogContext(ctx context.Context, level kratoslog.Level, keyvals ...interface{}) error {
+	logger := l.Logger
+	if ctxLogger, ok := caolog.LoggerFromContext(ctx); ok {
+		logger = ctxLogger
+	}
+	args := parseKeyvals(ctx, keyvals)
 	switch level {
 	case kratoslog.LevelDebug:
-		l.Logger.Debug(kratosDeep, msg...)
+		logger.CDebug(ctx, caolog.AutoDeep, args...)
 	case kratoslog.LevelInfo:
-		l.Logger.Info(kratosDeep, msg...)
+		logger.CInfo(ctx, caolog.AutoDeep, args...)
 	case kratoslog.LevelWarn:
-		l.Logger.Warn(kratosDeep, msg...)
+		logger.CWarn(ctx, caolog.AutoDeep, args...)
 	case kratoslog.LevelError:
-		l.Logger.Error(kratosDeep, msg...)
+		logger.CError(ctx, caolog.AutoDeep, args...)
 	case kratoslog.LevelFatal:
-		l.Logger.Fatal(kratosDeep, msg...)
+		logger.CFatal(ctx, caolog.AutoDeep, args...)
 	}
 	return nil
 }
 
-// KratosServer is an server logging middleware.
-func KratosServer(logger kratoslog.Logger) middleware.Middleware {
+// logContext logs with ctx when logger supports it, other kratos loggers only get ctx for their valuers
+func logContext(ctx context.Context, logger kratoslog.Logger, level kratoslog.Level, keyvals ...interface{}) {
+	if cl, ok := logger.(contextLogger); ok {
+		_ = cl.LogContext(ctx, level, keyvals...)
+		return
+	}
+	_ = kratoslog.WithContext(ctx, logger).Log(level, keyvals...)
+}
+
+// parseKeyvals returns the message followed by the other pairs as zap fields
+func parseKeyvals(ctx context.Context, keyvals []interface{}) []interface{} {
+	if len(keyvals)%2 != 0 {
+		keyvals = append(keyvals, "KEYVALS UNPAIRED")
+	}
+	var msg interface{}
+	args := make([]interface{}, 0, len(keyvals)/2+1)
+	for i := 0; i < len(keyvals); i += 2 {
+		key, ok := keyvals[i].(string)
+		if !ok {
+			key = fmt.Sprint(keyvals[i])
+		}
+		value := keyvals[i+1]
+		if valuer, ok := value.(kratoslog.Valuer); ok {
+			value = valuer(ctx)
+		}
+		if key == kratoslog.DefaultMessageKey {
+			msg = value
+			continue
+		}
+		args = append(args, caolog.Any(key, value))
+	}
+	if msg != nil {
+		args = append([]interface{}{msg}, args...)
+	}
+	return args
+}
+
+// KratosServer is an server logging middleware, the access line is the canonical line
+// of the request, handlers add fields to it with caolog.Annotate.
+func KratosServer(logger kratoslog.Logger, opts ...ServerOption) middleware.Middleware {
+	o := newServerOptions(opts...)
 	return func(handler middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
 			var (
@@ -55,27 +117,90 @@ func KratosServer(logger kratoslog.Logger) middleware.Middleware {
 				kind = info.Kind().String()
 				operation = info.Operation()
 			}
+			ctx, canonical := caolog.StartCanonical(ctx)
+			reply, err = handler(ctx, req)
+			if se := errors.FromError(err); se != nil {
+				code = se.Code
+				reason = se.Reason
+			}
+			latency := time.Since(startTime)
+			level := o.level(err, code, latency)
+			extra := append([]string{reason}, o.extractFields(ctx, req, reply)...)
+			if o.logPayload(operation) {
+				if o.request {
+					extra = append(extra, "req="+o.extractPayload(req))
+				}
+				if o.reply {
+					extra = append(extra, "reply="+o.extractPayload(reply))
+				}
+			}
+			keyvals := append([]interface{}{
+				"msg",
+				formatLine(code, latency, "server", kind, operation, extra...),
+			}, canonical.Keyvals(err)...)
+			logContext(ctx, logger, level, keyvals...)
+			return
+		}
+	}
+}
+
+// KratosClient is a client logging middleware.
+func KratosClient(logger kratoslog.Logger) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			var (
+				code      int32
+				reason    string
+				kind      string
+				operation string
+				endpoint  string
+			)
+			startTime := time.Now()
+			if info, ok := transport.FromClientContext(ctx); ok {
+				kind = info.Kind().String()
+				operation = info.Operation()
+				endpoint = info.Endpoint()
+			}
 			reply, err = handler(ctx, req)
 			if se := errors.FromError(err); se != nil {
 				code = se.Code
 				reason = se.Reason
 			}
 			level, _ := extractError(err)
-			_ = kratoslog.WithContext(ctx, logger).Log(level,
+			logContext(ctx, logger, level,
 				"msg",
-				fmt.Sprintf("[Kratos] %4d | %12s | %8s | %7s | %s\t%s",
-					code,
-					time.Since(startTime).String(),
-					"server",
-					kind,
-					operation,
-					reason),
+				formatLine(code, time.Since(startTime), "client", kind, operation, endpoint, extractTraceID(ctx), reason),
 			)
 			return
 		}
 	}
 }
 
+// formatLine returns the access line shared by server and client middlewares
+func formatLine(code int32, latency time.Duration, side, kind, operation string, extra ...string) string {
+	line := fmt.Sprintf("[Kratos] %4d | %12s | %8s | %7s | %s",
+		code,
+		latency.String(),
+		side,
+		kind,
+		operation)
+	for _, e := range extra {
+		// 缺少的列不输出，避免连续的空列
+		if e != "" {
+			line += "\t" + e
+		}
+	}
+	return line
+}
+
+// extractTraceID returns the trace id of the ctx
+func extractTraceID(ctx context.Context) string {
+	if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.HasTraceID() {
+		return spanCtx.TraceID().String()
+	}
+	return ""
+}
+
 // extractError returns the string of the error
 func extractError(err error) (kratoslog.Level, string) {
 	if err != nil {
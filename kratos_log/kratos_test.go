@@ -0,0 +1,296 @@
+package kratoslog_test
+
+import (
+	"bytes"
+	"context"
+	caolog "github.com/CaoStudio/caolog"
+	"github.com/CaoStudio/caolog/internal/caologtest"
+	kratoslog "github.com/CaoStudio/caolog/kratos_log"
+	"github.com/go-kratos/kratos/v2"
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/metadata"
+	"github.com/go-kratos/kratos/v2/transport"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/protobuf/types/known/structpb"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKratosServerPayload(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := kratoslog.NewKratosLogger(caologtest.NewBufferLogger(buf))
+	req, _ := structpb.NewStruct(map[string]interface{}{
+		"name":      "cao",
+		"password":  "secret",
+		"id_number": "110101199003074477",
+	})
+	reply := strings.Repeat("ok", 100)
+
+	handler := kratoslog.KratosServer(logger,
+		kratoslog.WithRequestPayload(),
+		kratoslog.WithReplyPayload(),
+		kratoslog.WithMaxPayloadSize(128),
+		kratoslog.WithRedactFields("password", "idNumber"),
+	)(func(ctx context.Context, _ interface{}) (interface{}, error) {
+		caolog.Annotate(ctx, "cache_hit", true)
+		return reply, nil
+	})
+	if _, err := handler(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if strings.Contains(out, "secret") || strings.Contains(out, "110101") ||
+		!strings.Contains(out, `"password":"***"`) || !strings.Contains(out, `"id_number":"***"`) {
+		t.Fatalf("sensitive fields not redacted: %q", out)
+	}
+	if !strings.Contains(out, `"cache_hit": true`) || !strings.Contains(out, `"outcome": "ok"`) {
+		t.Fatalf("canonical fields missing: %q", out)
+	}
+	if !strings.Contains(out, "req=") || !strings.Contains(out, "reply="+strings.Repeat("ok", 64)+"...(72 bytes truncated)") {
+		t.Fatalf("unexpected output %q", out)
+	}
+}
+
+func TestKratosServerStructPayload(t *testing.T) {
+	type loginRequest struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+	buf := &bytes.Buffer{}
+	logger := kratoslog.NewKratosLogger(caologtest.NewBufferLogger(buf))
+	handler := kratoslog.KratosServer(logger,
+		kratoslog.WithRequestPayload(),
+		kratoslog.WithReplyPayload(),
+		kratoslog.WithRedactFields("password"),
+	)(func(context.Context, interface{}) (interface{}, error) {
+		return make(chan int), nil
+	})
+	if _, err := handler(context.Background(), &loginRequest{Name: "cao", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if strings.Contains(out, "secret") || !strings.Contains(out, `req={"name":"cao","password":"***"}`) {
+		t.Fatalf("struct payloads should be redacted as json: %q", out)
+	}
+	if !strings.Contains(out, "reply=[payload omitted: cannot redact]") {
+		t.Fatalf("payloads that cannot be redacted should be omitted: %q", out)
+	}
+}
+
+func TestKratosServerDenyPayload(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := kratoslog.NewKratosLogger(caologtest.NewBufferLogger(buf))
+	handler := kratoslog.KratosServer(logger,
+		kratoslog.WithRequestPayload(),
+		kratoslog.WithDenyOperations(""),
+	)(func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	_, _ = handler(context.Background(), "hello")
+	if strings.Contains(buf.String(), "req=") {
+		t.Fatalf("denied payload logged: %q", buf.String())
+	}
+}
+
+func TestKratosServerLevel(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := kratoslog.NewKratosLogger(caologtest.NewBufferLogger(buf))
+	middleware := kratoslog.KratosServer(logger,
+		kratoslog.WithCodeLevel(kratoslog.HTTPCodeLevel),
+		kratoslog.WithSlowThreshold(time.Millisecond),
+		kratoslog.WithFields(kratoslog.FieldRequestSize),
+	)
+
+	_, _ = middleware(func(context.Context, interface{}) (interface{}, error) {
+		return nil, errors.BadRequest("INVALID", "bad name")
+	})(context.Background(), "hello")
+	if !strings.HasPrefix(buf.String(), "WARN") || !strings.Contains(buf.String(), "req_size=5") {
+		t.Fatalf("expected warn for 4xx, got %q", buf.String())
+	}
+
+	buf.Reset()
+	_, _ = middleware(func(context.Context, interface{}) (interface{}, error) {
+		return nil, errors.InternalServer("DB", "down")
+	})(context.Background(), nil)
+	if !strings.HasPrefix(buf.String(), "ERROR") {
+		t.Fatalf("expected error for 5xx, got %q", buf.String())
+	}
+
+	buf.Reset()
+	_, _ = middleware(func(context.Context, interface{}) (interface{}, error) {
+		time.Sleep(2 * time.Millisecond)
+		return nil, nil
+	})(context.Background(), nil)
+	if !strings.HasPrefix(buf.String(), "WARN") {
+		t.Fatalf("expected warn for slow request, got %q", buf.String())
+	}
+}
+
+func TestLevelServerTrusted(t *testing.T) {
+	type trustedKey struct{}
+	middleware := kratoslog.LevelServer(func(ctx context.Context) bool {
+		return ctx.Value(trustedKey{}) != nil
+	})
+	handler := middleware(func(ctx context.Context, _ interface{}) (interface{}, error) {
+		level, ok := caolog.LevelFromContext(ctx)
+		md, _ := metadata.FromServerContext(ctx)
+		return []interface{}{level, ok, md.Get(kratoslog.LevelMetadataKey)}, nil
+	})
+	ctx := metadata.NewServerContext(context.Background(), metadata.New(map[string][]string{
+		kratoslog.LevelMetadataKey: {"debug"},
+	}))
+
+	reply, _ := handler(ctx, nil)
+	if got := reply.([]interface{}); got[1] != false || got[2] != "" {
+		t.Fatalf("untrusted level must be ignored and stripped, got %v", got)
+	}
+	reply, _ = handler(context.WithValue(ctx, trustedKey{}, true), nil)
+	if got := reply.([]interface{}); got[0] != zapcore.DebugLevel || got[1] != true {
+		t.Fatalf("trusted level must be applied, got %v", got)
+	}
+}
+
+func TestLoggerKeyvals(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := kratoslog.NewKratosLogger(caologtest.NewBufferLogger(buf))
+	helper := log.NewHelper(log.With(logger, "service.name", "greeter", "ts", log.Valuer(func(context.Context) interface{} {
+		return "now"
+	})))
+
+	helper.Infow("msg", "hello", "user", 42)
+	_, file, line, _ := runtime.Caller(0)
+	out := buf.String()
+	caller := filepath.Base(file) + ":" + strconv.Itoa(line-1)
+	if !strings.Contains(out, caller) {
+		t.Fatalf("expected caller %s, got %q", caller, out)
+	}
+	for _, want := range []string{"hello", `"service.name": "greeter"`, `"ts": "now"`, `"user": 42`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %s in %q", want, out)
+		}
+	}
+	if strings.Contains(out, `"msg"`) {
+		t.Fatalf("msg should be the message, got %q", out)
+	}
+}
+
+func TestServiceOption(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := caologtest.NewBufferLogger(buf)
+	logger.Options = append(logger.Options, kratoslog.ServiceOption("id-1", "greeter", "v1", "prod"))
+
+	logger.CInfo(context.Background(), 2, "hello")
+	if !strings.Contains(buf.String(), `"service.name": "greeter", "service.version": "v1", "service.env": "prod"`) {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+
+	buf.Reset()
+	app := kratos.New(kratos.ID("id-2"), kratos.Name("order"), kratos.Version("v2"))
+	logger.CInfo(kratos.NewContext(context.Background(), app), 2, "hello")
+	if !strings.Contains(buf.String(), `"service.id": "id-2", "service.name": "order", "service.version": "v2", "service.env": "prod"`) {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+}
+
+type headerCarrier http.Header
+
+func (h headerCarrier) Get(key string) string      { return http.Header(h).Get(key) }
+func (h headerCarrier) Set(key, value string)      { http.Header(h).Set(key, value) }
+func (h headerCarrier) Add(key, value string)      { http.Header(h).Add(key, value) }
+func (h headerCarrier) Keys() []string             { return nil }
+func (h headerCarrier) Values(key string) []string { return http.Header(h).Values(key) }
+
+type testTransport struct {
+	header   headerCarrier
+	endpoint string
+}
+
+func (tr *testTransport) Kind() transport.Kind            { return transport.KindHTTP }
+func (tr *testTransport) Endpoint() string                { return tr.endpoint }
+func (tr *testTransport) Operation() string               { return "/test" }
+func (tr *testTransport) RequestHeader() transport.Header { return tr.header }
+func (tr *testTransport) ReplyHeader() transport.Header   { return headerCarrier{} }
+
+func TestMetadata(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := caologtest.NewBufferLogger(buf)
+	logger.Options = append(logger.Options, caolog.ContextFields)
+
+	server := &testTransport{header: headerCarrier{}}
+	server.header.Set("x-md-global-request-id", "req-1")
+	client := &testTransport{header: headerCarrier{}}
+
+	handler := kratoslog.MetadataServer("x-md-global-request-id", "x-md-global-user")(func(ctx context.Context, req interface{}) (interface{}, error) {
+		logger.CInfo(ctx, 2, "handling")
+		return kratoslog.MetadataClient()(func(context.Context, interface{}) (interface{}, error) {
+			return nil, nil
+		})(transport.NewClientContext(ctx, client), req)
+	})
+	_, _ = handler(transport.NewServerContext(context.Background(), server), nil)
+
+	if !strings.Contains(buf.String(), `"x-md-global-request-id": "req-1"`) || strings.Contains(buf.String(), "x-md-global-user") {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+	if client.header.Get("x-md-global-request-id") != "req-1" {
+		t.Fatalf("metadata not propagated: %v", client.header)
+	}
+}
+
+func TestKratosClient(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := kratoslog.NewKratosLogger(caologtest.NewBufferLogger(buf))
+	traceID := trace.TraceID{1, 2, 3}
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID}))
+	ctx = transport.NewClientContext(ctx, &testTransport{header: headerCarrier{}, endpoint: "127.0.0.1:9000"})
+
+	_, _ = kratoslog.KratosClient(logger)(func(context.Context, interface{}) (interface{}, error) {
+		return nil, errors.NotFound("USER_NOT_FOUND", "user not found")
+	})(ctx, nil)
+	out := buf.String()
+	for _, want := range []string{"ERROR", " 404 |", "client", "/test", "127.0.0.1:9000", traceID.String(), "USER_NOT_FOUND"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("client line should contain %q, got %q", want, out)
+		}
+	}
+
+	buf.Reset()
+	ctx = transport.NewClientContext(context.Background(), &testTransport{header: headerCarrier{}})
+	_, _ = kratoslog.KratosClient(logger)(func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	})(ctx, nil)
+	if out := buf.String(); !strings.HasPrefix(out, "INFO") || !strings.Contains(out, "   0 |") || strings.Contains(out, "\t\t") {
+		t.Fatalf("missing endpoint and trace should not leave empty columns, got %q", out)
+	}
+}
+
+func TestKratosServerContext(t *testing.T) {
+	defer caolog.SetLevel(caolog.GetLevel())
+	caolog.SetLevel(caolog.WarnLevel)
+	buf := &bytes.Buffer{}
+	base := caologtest.NewBufferLogger(buf)
+	base.Options = append(base.Options, caolog.ContextFields)
+	handler := kratoslog.KratosServer(kratoslog.NewKratosLogger(base))(func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	})
+
+	ctx := caolog.WithLevel(caolog.WithFields(context.Background(), "request_id", "req-1"), caolog.InfoLevel)
+	_, _ = handler(ctx, nil)
+	if out := buf.String(); !strings.Contains(out, `"request_id": "req-1"`) || !strings.Contains(out, `"outcome": "ok"`) {
+		t.Fatalf("access line should use the request ctx: %q", out)
+	}
+
+	ctxBuf := &bytes.Buffer{}
+	_, _ = handler(caolog.NewContext(ctx, caologtest.NewBufferLogger(ctxBuf)), nil)
+	if ctxBuf.Len() == 0 {
+		t.Fatalf("access line should prefer the ctx logger")
+	}
+}
@@ -0,0 +1,56 @@
+package kratoslog
+
+import (
+	"context"
+	"github.com/CaoStudio/caolog"
+	"github.com/go-kratos/kratos/v2/metadata"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"go.uber.org/zap/zapcore"
+)
+
+// LevelMetadataKey is the metadata key of the request level, the x-md-global- prefix
+// keeps it propagated by the kratos metadata middleware as well.
+const LevelMetadataKey = "x-md-global-log-level"
+
+// LevelServer is a server middleware, it applies the request level carried by
+// LevelMetadataKey to ctx, see caolog.WithLevel.
+//
+// Any caller can set LevelMetadataKey, trusted decides whether the request is allowed
+// to change its level, e.g. by checking the caller identity set by an auth middleware.
+// An untrusted level is ignored and removed from the server metadata, so the metadata
+// middleware does not propagate it to the next service either. A nil trusted accepts
+// every request, it is only safe behind a gateway that strips LevelMetadataKey from
+// external requests.
+func LevelServer(trusted func(ctx context.Context) bool) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if value := serverMetadata(ctx, LevelMetadataKey); value != "" {
+				if trusted == nil || trusted(ctx) {
+					if level, err := zapcore.ParseLevel(value); err == nil {
+						ctx = caolog.WithLevel(ctx, level)
+					}
+				} else if md, ok := metadata.FromServerContext(ctx); ok && md.Get(LevelMetadataKey) != "" {
+					md = md.Clone()
+					delete(md, LevelMetadataKey)
+					ctx = metadata.NewServerContext(ctx, md)
+				}
+			}
+			return handler(ctx, req)
+		}
+	}
+}
+
+// LevelClient is a client middleware, it propagates the request level of ctx to the next service.
+func LevelClient() middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if level, ok := caolog.LevelFromContext(ctx); ok {
+				if tr, ok := transport.FromClientContext(ctx); ok {
+					tr.RequestHeader().Set(LevelMetadataKey, level.String())
+				}
+			}
+			return handler(ctx, req)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package kratoslog
+
+import (
+	"context"
+	"github.com/CaoStudio/caolog"
+	"github.com/go-kratos/kratos/v2/metadata"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"go.uber.org/zap"
+)
+
+type (
+	metadataKey struct{}
+
+	metadataPair struct {
+		key   string
+		value string
+	}
+)
+
+// MetadataServer is a server middleware, it extracts the given metadata keys into ctx,
+// they are logged as caolog.WithFields and MetadataClient propagates them to the next service.
+func MetadataServer(keys ...string) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			pairs := make([]metadataPair, 0, len(keys))
+			fields := make([]interface{}, 0, len(keys))
+			for _, key := range keys {
+				if value := serverMetadata(ctx, key); value != "" {
+					pairs = append(pairs, metadataPair{key: key, value: value})
+					fields = append(fields, zap.String(key, value))
+				}
+			}
+			if len(pairs) > 0 {
+				ctx = context.WithValue(ctx, metadataKey{}, append(metadataFromContext(ctx), pairs...))
+				ctx = caolog.WithFields(ctx, fields...)
+			}
+			return handler(ctx, req)
+		}
+	}
+}
+
+// MetadataClient is a client middleware, it injects the metadata extracted by MetadataServer into the request header.
+func MetadataClient() middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if tr, ok := transport.FromClientContext(ctx); ok {
+				for _, pair := range metadataFromContext(ctx) {
+					tr.RequestHeader().Set(pair.key, pair.value)
+				}
+			}
+			return handler(ctx, req)
+		}
+	}
+}
+
+// metadataFromContext returns the metadata extracted into ctx, callers must not modify it
+func metadataFromContext(ctx context.Context) []metadataPair {
+	pairs, _ := ctx.Value(metadataKey{}).([]metadataPair)
+	return pairs[:len(pairs):len(pairs)]
+}
+
+// serverMetadata returns the value of key in the kratos metadata or the request header of the server transport
+func serverMetadata(ctx context.Context, key string) string {
+	if md, ok := metadata.FromServerContext(ctx); ok {
+		if value := md.Get(key); value != "" {
+			return value
+		}
+	}
+	if tr, ok := transport.FromServerContext(ctx); ok {
+		return tr.RequestHeader().Get(key)
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package kratoslog
+
+import (
+	kratoslog "github.com/go-kratos/kratos/v2/log"
+	"time"
+)
+
+type (
+	// ServerOption is KratosServer option.
+	ServerOption func(*serverOptions)
+
+	serverOptions struct {
+		request      bool
+		reply        bool
+		maxSize      int
+		allow        []string
+		deny         []string
+		redactNames  map[string]struct{}
+		fields       []Field
+		metadataKeys []string
+		slow         time.Duration
+		codeLevel    CodeLevelFunc
+	}
+)
+
+func newServerOptions(opts ...ServerOption) *serverOptions {
+	o := &serverOptions{
+		maxSize:     defaultMaxPayloadSize,
+		redactNames: make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// level returns the level of the access line
+func (o *serverOptions) level(err error, code int32, latency time.Duration) kratoslog.Level {
+	if err != nil {
+		if o.codeLevel != nil {
+			return o.codeLevel(code)
+		}
+		level, _ := extractError(err)
+		return level
+	}
+	if o.slow > 0 && latency >= o.slow {
+		return kratoslog.LevelWarn
+	}
+	return kratoslog.LevelInfo
+}
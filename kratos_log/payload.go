@@ -0,0 +1,175 @@
+package kratoslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultMaxPayloadSize = 1024
+	redactedValue         = "***"
+	// unredactablePayload 配置了脱敏字段但 payload 无法编码为 JSON 时的输出
+	unredactablePayload = "[payload omitted: cannot redact]"
+)
+
+// WithRequestPayload logs the request payload.
+func WithRequestPayload() ServerOption {
+	return func(o *serverOptions) {
+		o.request = true
+	}
+}
+
+// WithReplyPayload logs the reply payload.
+func WithReplyPayload() ServerOption {
+	return func(o *serverOptions) {
+		o.reply = true
+	}
+}
+
+// WithMaxPayloadSize truncates payloads longer than size bytes, size <= 0 disables truncation.
+func WithMaxPayloadSize(size int) ServerOption {
+	return func(o *serverOptions) {
+		o.maxSize = size
+	}
+}
+
+// WithAllowOperations only logs payloads of the given operations or operation prefixes.
+func WithAllowOperations(operations ...string) ServerOption {
+	return func(o *serverOptions) {
+		o.allow = append(o.allow, operations...)
+	}
+}
+
+// WithDenyOperations never logs payloads of the given operations or operation prefixes.
+func WithDenyOperations(operations ...string) ServerOption {
+	return func(o *serverOptions) {
+		o.deny = append(o.deny, operations...)
+	}
+}
+
+// WithRedactFields replaces the value of the given fields with "***", names match both snake_case and camelCase.
+func WithRedactFields(fields ...string) ServerOption {
+	return func(o *serverOptions) {
+		for _, field := range fields {
+			o.redactNames[normalizeName(field)] = struct{}{}
+		}
+	}
+}
+
+// logPayload reports whether the payloads of operation should be logged
+func (o *serverOptions) logPayload(operation string) bool {
+	if !o.request && !o.reply {
+		return false
+	}
+	for _, deny := range o.deny {
+		if strings.HasPrefix(operation, deny) {
+			return false
+		}
+	}
+	if len(o.allow) == 0 {
+		return true
+	}
+	for _, allow := range o.allow {
+		if strings.HasPrefix(operation, allow) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractPayload returns the redacted and truncated string of the payload
+func (o *serverOptions) extractPayload(payload interface{}) string {
+	if payload == nil {
+		return ""
+	}
+	var text string
+	if message, ok := payload.(proto.Message); ok {
+		data, err := protojson.Marshal(message)
+		if err != nil {
+			text = extractArgs(payload)
+		} else {
+			text = string(o.redact(data))
+		}
+	} else if len(o.redactNames) == 0 {
+		text = extractArgs(payload)
+	} else {
+		text = o.redactOther(payload)
+	}
+	return o.truncate(text)
+}
+
+// redactOther 将非 proto 的 payload 编码为 JSON 后再脱敏，无法编码时不输出内容，避免 %+v 泄露字段
+func (o *serverOptions) redactOther(payload interface{}) string {
+	switch v := payload.(type) {
+	case string:
+		if strings.HasPrefix(v, "{") || strings.HasPrefix(v, "[") {
+			return string(o.redact([]byte(v)))
+		}
+		return v
+	case []byte:
+		return o.redactOther(string(v))
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return unredactablePayload
+	}
+	return string(o.redact(data))
+}
+
+// redact replaces the values of redacted fields in the json data, data that is not json is returned unchanged
+func (o *serverOptions) redact(data []byte) []byte {
+	if len(o.redactNames) == 0 {
+		return data
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return data
+	}
+	redacted, err := json.Marshal(o.redactValue(value))
+	if err != nil {
+		return data
+	}
+	return redacted
+}
+
+func (o *serverOptions) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if _, ok := o.redactNames[normalizeName(key)]; ok {
+				v[key] = redactedValue
+			} else {
+				v[key] = o.redactValue(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = o.redactValue(item)
+		}
+	}
+	return value
+}
+
+// truncate cuts text to maxSize bytes without splitting a utf8 character
+func (o *serverOptions) truncate(text string) string {
+	if o.maxSize <= 0 || len(text) <= o.maxSize {
+		return text
+	}
+	end := o.maxSize
+	for end > 0 && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	return text[:end] + "...(" + strconv.Itoa(len(text)-end) + " bytes truncated)"
+}
+
+// normalizeName makes id_number, idNumber and IDNumber equal
+func normalizeName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
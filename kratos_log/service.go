@@ -0,0 +1,77 @@
+package kratoslog
+
+import (
+	"context"
+	"github.com/CaoStudio/caolog"
+	"github.com/go-kratos/kratos/v2"
+	"go.uber.org/zap"
+)
+
+// envMetadataKey 是 kratos.Metadata 中表示环境的 key
+const envMetadataKey = "env"
+
+type serviceInfo struct {
+	id      string
+	name    string
+	version string
+	env     string
+}
+
+// ServiceOption stamps every record with the service info, the kratos AppInfo in ctx takes precedence over the args.
+func ServiceOption(id, name, version, env string) caolog.Option {
+	info := serviceInfo{id: id, name: name, version: version, env: env}
+	return func(ctx context.Context, details *caolog.Details) {
+		if app, ok := kratos.FromContext(ctx); ok {
+			info := appServiceInfo(app)
+			if info.env == "" {
+				info.env = env
+			}
+			info.stamp(details)
+			return
+		}
+		info.stamp(details)
+	}
+}
+
+// AppOption stamps every record with the info of app, the env is read from the "env" metadata.
+func AppOption(app kratos.AppInfo) caolog.Option {
+	info := appServiceInfo(app)
+	return func(ctx context.Context, details *caolog.Details) {
+		info.stamp(details)
+	}
+}
+
+// WithAppInfo is a kratos app option, it adds AppOption of the app to the global logger before start.
+func WithAppInfo() kratos.Option {
+	return kratos.BeforeStart(func(ctx context.Context) error {
+		if app, ok := kratos.FromContext(ctx); ok {
+			caolog.With(AppOption(app))
+		}
+		return nil
+	})
+}
+
+func appServiceInfo(app kratos.AppInfo) serviceInfo {
+	return serviceInfo{
+		id:      app.ID(),
+		name:    app.Name(),
+		version: app.Version(),
+		env:     app.Metadata()[envMetadataKey],
+	}
+}
+
+// stamp appends the non-empty service fields to details
+func (s serviceInfo) stamp(details *caolog.Details) {
+	if s.id != "" {
+		details.Fields = append(details.Fields, zap.String("service.id", s.id))
+	}
+	if s.name != "" {
+		details.Fields = append(details.Fields, zap.String("service.name", s.name))
+	}
+	if s.version != "" {
+		details.Fields = append(details.Fields, zap.String("service.version", s.version))
+	}
+	if s.env != "" {
+		details.Fields = append(details.Fields, zap.String("service.env", s.env))
+	}
+}
@@ -0,0 +1,206 @@
+package caolog
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/baggage"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// BaggageLevelKey 是 otel baggage 中请求级别的 key，如 log.level=debug
+const BaggageLevelKey = "log.level"
+
+type levelKey struct{}
+
+var (
+	// atomicLevel SetLevel 设置的全局级别，日志调用时读取它以支持运行时修改
+	atomicLevel = zap.NewAtomicLevelAt(DebugLevel)
+	// assignedLevel 是最近一次 SetLevel 设置的级别，与 Level 不同说明 Level 之后被直接赋值过
+	assignedLevel atomic.Int32
+	// namedLevels 按 Logger 名称配置的级别，写时复制
+	namedLevels   atomic.Pointer[map[string]zapcore.Level]
+	namedLevelsMu sync.Mutex
+)
+
+// SetLevel 修改全局日志级别，同时更新已弃用的 Level 以便旧代码读到相同的值；
+// Level 的读写不是并发安全的，在日志调用的同时修改级别（如配置热更新）请使用 AtomicLevel
+func SetLevel(level zapcore.Level) {
+	Level = level
+	assignedLevel.Store(int32(level))
+	atomicLevel.SetLevel(level)
+}
+
+// AtomicLevel 返回全局级别，可以在日志调用的同时修改，也可以作为 zap 的级别 HTTP 接口；
+// 不会更新 Level，Level 被直接赋值后以 Level 为准，直到下一次 SetLevel
+func AtomicLevel() zap.AtomicLevel {
+	return atomicLevel
+}
+
+// GetLevel 返回当前的全局日志级别
+func GetLevel() zapcore.Level {
+	return globalLevel()
+}
+
+// globalLevel 兼容直接给 Level 赋值的旧用法：Level 在最近一次 SetLevel 之后被修改过时以它为准
+func globalLevel() zapcore.Level {
+	if level := Level; int32(level) != assignedLevel.Load() {
+		return level
+	}
+	return atomicLevel.Level()
+}
+
+// SetNamedLevel 为名称为 name 的 Logger 及其子 Logger 单独设置级别
+func SetNamedLevel(name string, level zapcore.Level) {
+	namedLevelsMu.Lock()
+	defer namedLevelsMu.Unlock()
+	levels := make(map[string]zapcore.Level)
+	if old := namedLevels.Load(); old != nil {
+		for k, v := range *old {
+			levels[k] = v
+		}
+	}
+	levels[name] = level
+	namedLevels.Store(&levels)
+}
+
+// SetNamedLevels 用 levels 替换所有按名称配置的级别
+func SetNamedLevels(levels map[string]zapcore.Level) {
+	namedLevelsMu.Lock()
+	defer namedLevelsMu.Unlock()
+	copied := make(map[string]zapcore.Level, len(levels))
+	for k, v := range levels {
+		copied[k] = v
+	}
+	namedLevels.Store(&copied)
+}
+
+// Named 返回一个子 Logger，名称以 "." 连接，与 zap 的 Named 一致
+func (l *Logger) Named(name string) *Logger {
+	if l.name != "" {
+		name = l.name + "." + name
+	}
+	child := l.Child()
+	child.name = name
+	if sink := l.sinkLogger(); sink != l.Logger {
+		child.setSink(sink.Named(name[strings.LastIndexByte(name, '.')+1:]))
+		return child
+	}
+	child.Logger = l.Logger.Named(name[strings.LastIndexByte(name, '.')+1:])
+	return child
+}
+
+// setSink 设置 caolog 自身写日志使用的 sink，并将 Logger 设置为按级别配置过滤的 sink，
+// 直接使用 Logger、Sugar 的调用方同样遵循全局与按名称配置的级别
+func (l *Logger) setSink(sink *zap.Logger) {
+	name := l.name
+	l.sink = sink
+	l.Logger = sink.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		filtered, err := zapcore.NewIncreaseLevelCore(core, zap.LevelEnablerFunc(func(level zapcore.Level) bool {
+			return namedLevelEnabled(name, level)
+		}))
+		if err != nil {
+			return core
+		}
+		return filtered
+	}))
+	l.sinkFor = l.Logger
+}
+
+// sinkLogger 返回 caolog 写日志使用的 zap logger，级别已经由 caolog 判断；
+// Logger 被替换过时 sink 不再对应它，直接使用 Logger
+func (l *Logger) sinkLogger() *zap.Logger {
+	if l.sink != nil && l.sinkFor == l.Logger {
+		return l.sink
+	}
+	return l.Logger
+}
+
+// Name 返回 Logger 的名称
+func (l *Logger) Name() string {
+	return l.name
+}
+
+// WithLevel 返回携带请求级别的 ctx，使用该 ctx 的日志按更详细的一方判断是否输出
+func WithLevel(ctx context.Context, level zapcore.Level) context.Context {
+	return context.WithValue(ctx, levelKey{}, level)
+}
+
+// LevelFromContext 返回 ctx 中的请求级别，来自 WithLevel 或 otel baggage 中的 log.level
+func LevelFromContext(ctx context.Context) (zapcore.Level, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	if level, ok := ctx.Value(levelKey{}).(zapcore.Level); ok {
+		return level, true
+	}
+	if value := baggage.FromContext(ctx).Member(BaggageLevelKey).Value(); value != "" {
+		if level, err := zapcore.ParseLevel(value); err == nil {
+			return level, true
+		}
+	}
+	return 0, false
+}
+
+// Enabled 返回 level 的日志是否会被输出，调用方可以在构造开销较大的参数之前判断
+func (l *Logger) Enabled(level zapcore.Level) bool {
+	return l.enabled(context.Background(), level)
+}
+
+// CEnabled 与 Enabled 相同，同时考虑 ctx 中的请求级别
+func (l *Logger) CEnabled(ctx context.Context, level zapcore.Level) bool {
+	return l.enabled(ctx, level)
+}
+
+// Enabled 使用全局 logger 判断 level 的日志是否会被输出
+func Enabled(level zapcore.Level) bool {
+	return logger.Enabled(level)
+}
+
+// CEnabled 使用 ctx 中的 logger 判断 level 的日志是否会被输出
+func CEnabled(ctx context.Context, level zapcore.Level) bool {
+	return FromContext(ctx).CEnabled(ctx, level)
+}
+
+// enabled 判断 level 是否需要输出：优先使用名称最接近的级别配置，否则使用全局级别；
+// ctx 中的请求级别只能让日志更详细，不能屏蔽原本会输出的日志；
+// 最终还需要 zap core 接受该级别，否则格式化与 Options 都是白做
+func (l *Logger) enabled(ctx context.Context, level zapcore.Level) bool {
+	if !l.levelEnabled(level) {
+		min, ok := LevelFromContext(ctx)
+		if !ok || level < min {
+			return false
+		}
+	}
+	return l.sinkEnabled(level)
+}
+
+// sinkEnabled 判断 zap core 是否接受 level
+func (l *Logger) sinkEnabled(level zapcore.Level) bool {
+	return l.sinkLogger().Core().Enabled(level)
+}
+
+func (l *Logger) levelEnabled(level zapcore.Level) bool {
+	return namedLevelEnabled(l.name, level)
+}
+
+// namedLevelEnabled 使用名称为 name 的 Logger 的级别判断 level 是否需要输出
+func namedLevelEnabled(name string, level zapcore.Level) bool {
+	if name != "" {
+		if levels := namedLevels.Load(); levels != nil && len(*levels) > 0 {
+			for {
+				if min, ok := (*levels)[name]; ok {
+					return level >= min
+				}
+				i := strings.LastIndexByte(name, '.')
+				if i < 0 {
+					break
+				}
+				name = name[:i]
+			}
+		}
+	}
+	return level >= globalLevel()
+}
@@ -0,0 +1,142 @@
+package caolog_test
+
+import (
+	"bytes"
+	"context"
+	caolog "github.com/CaoStudio/caolog"
+	"github.com/CaoStudio/caolog/internal/caologtest"
+	"go.opentelemetry.io/otel/baggage"
+	"testing"
+)
+
+func TestContextLevel(t *testing.T) {
+	defer caolog.SetLevel(caolog.GetLevel())
+	caolog.SetLevel(caolog.InfoLevel)
+	buf := &bytes.Buffer{}
+	logger := caologtest.NewBufferLogger(buf)
+
+	logger.CDebug(context.Background(), 2, "hidden")
+	if buf.Len() != 0 {
+		t.Fatalf("debug should be disabled, got %q", buf.String())
+	}
+
+	logger.CDebug(caolog.WithLevel(context.Background(), caolog.DebugLevel), 2, "shown")
+	if buf.Len() == 0 {
+		t.Fatalf("request level should enable debug")
+	}
+
+	buf.Reset()
+	member, _ := baggage.NewMember(caolog.BaggageLevelKey, "debug")
+	bag, _ := baggage.New(member)
+	logger.CDebug(baggage.ContextWithBaggage(context.Background(), bag), 2, "shown")
+	if buf.Len() == 0 {
+		t.Fatalf("baggage level should enable debug")
+	}
+
+	buf.Reset()
+	logger.CInfo(caolog.WithLevel(context.Background(), caolog.ErrorLevel), 2, "shown")
+	if buf.Len() == 0 {
+		t.Fatalf("request level must not hide enabled logs")
+	}
+}
+
+func TestNamedLevel(t *testing.T) {
+	defer caolog.SetLevel(caolog.GetLevel())
+	defer caolog.SetNamedLevels(nil)
+	caolog.SetLevel(caolog.InfoLevel)
+	caolog.SetNamedLevel("order", caolog.DebugLevel)
+	buf := &bytes.Buffer{}
+	logger := caologtest.NewBufferLogger(buf)
+
+	logger.Named("order").Named("repo").CDebug(context.Background(), 2, "shown")
+	if buf.Len() == 0 {
+		t.Fatalf("named level should enable debug for children")
+	}
+	buf.Reset()
+	logger.Named("user").CDebug(context.Background(), 2, "hidden")
+	if buf.Len() != 0 {
+		t.Fatalf("other names use the global level, got %q", buf.String())
+	}
+}
+
+func TestEnabledAndLazy(t *testing.T) {
+	defer caolog.SetLevel(caolog.GetLevel())
+	caolog.SetLevel(caolog.DebugLevel)
+	buf := &bytes.Buffer{}
+	logger := caologtest.NewBufferLoggerAt(buf, caolog.WarnLevel)
+
+	if logger.Enabled(caolog.InfoLevel) || !logger.Enabled(caolog.WarnLevel) {
+		t.Fatalf("Enabled should combine the logger and core levels")
+	}
+
+	calls := 0
+	lazy := caolog.Lazy(func() interface{} {
+		calls++
+		return "expensive"
+	})
+	logger.CInfo(context.Background(), caolog.AutoDeep, lazy)
+	if calls != 0 || buf.Len() != 0 {
+		t.Fatalf("lazy value should not be evaluated for disabled levels, calls %d", calls)
+	}
+	logger.CWarn(context.Background(), caolog.AutoDeep, lazy)
+	if calls != 1 || !bytes.Contains(buf.Bytes(), []byte("expensive")) {
+		t.Fatalf("lazy value should be evaluated once, calls %d, got %q", calls, buf.String())
+	}
+}
+
+func TestDeprecatedLevel(t *testing.T) {
+	oldVar, oldLevel := caolog.Level, caolog.GetLevel()
+	defer func() {
+		caolog.Level = oldVar
+		caolog.SetLevel(oldLevel)
+	}()
+	caolog.SetLevel(caolog.DebugLevel)
+	buf := &bytes.Buffer{}
+	logger := caologtest.NewBufferLogger(buf)
+
+	caolog.Level = caolog.ErrorLevel
+	logger.CDebug(context.Background(), caolog.AutoDeep, "hidden")
+	if buf.Len() != 0 || caolog.GetLevel() != caolog.ErrorLevel {
+		t.Fatalf("assigning Level should still change the global level, got %q", buf.String())
+	}
+
+	caolog.SetLevel(caolog.DebugLevel)
+	logger.CDebug(context.Background(), caolog.AutoDeep, "shown")
+	if buf.Len() == 0 {
+		t.Fatalf("SetLevel should take over after Level was assigned")
+	}
+
+	caolog.SetLevel(caolog.InfoLevel)
+	if caolog.Level != caolog.InfoLevel {
+		t.Fatalf("SetLevel should update Level, got %v", caolog.Level)
+	}
+	caolog.Level = caolog.DebugLevel
+	if caolog.GetLevel() != caolog.DebugLevel || !caolog.Enabled(caolog.DebugLevel) {
+		t.Fatalf("assigning Level back to debug should enable debug, got %v", caolog.GetLevel())
+	}
+}
+
+func TestInitLoggerLevelFilter(t *testing.T) {
+	defer caolog.SetLevel(caolog.GetLevel())
+	defer caolog.SetNamedLevels(nil)
+	global := caolog.GetLogger()
+	saved := *global
+	defer func() { *global = saved }()
+
+	caolog.InitLogger(caolog.InfoLevel)
+	caolog.SetNamedLevel("order", caolog.DebugLevel)
+	logger := caolog.GetLogger()
+	if logger.Logger.Core().Enabled(caolog.DebugLevel) || !logger.Logger.Core().Enabled(caolog.InfoLevel) {
+		t.Fatalf("the embedded zap logger should follow the global level")
+	}
+	if !logger.Named("order").Logger.Core().Enabled(caolog.DebugLevel) {
+		t.Fatalf("the embedded zap logger should follow named levels")
+	}
+	if !logger.CEnabled(caolog.WithLevel(context.Background(), caolog.DebugLevel), caolog.DebugLevel) {
+		t.Fatalf("request levels should still enable debug")
+	}
+	caolog.SetLevel(caolog.DebugLevel)
+	if !logger.Logger.Core().Enabled(caolog.DebugLevel) {
+		t.Fatalf("the embedded zap logger should follow SetLevel")
+	}
+}
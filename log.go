@@ -2,38 +2,44 @@ package caolog
 
 import (
 	"context"
-	"github.com/bytedance/sonic"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"io"
 	"os"
-	"runtime"
-	"strconv"
-	"strings"
 	"time"
-	"unsafe"
 )
 
 var (
 	logger *Logger
+	// Level 全局日志级别
+	//
+	// Deprecated: 直接赋值仍然生效但不是并发安全的；
+	// 运行时修改请使用 SetLevel，读取请使用 GetLevel
 	Level  zapcore.Level
 	writer io.Writer
 )
 
-const (
-	logDeep = 4
-	tabByte = byte('\t')
-)
+const tabByte = byte('\t')
 
 type (
 	Logger struct {
 		*zap.Logger
 		Options []Option
+		// JSON 为 true 时 Path 与 Fields 作为独立字段输出，由 InitJSONLogger 设置
+		JSON bool
+		// 由 Named 设置，用于查找按名称配置的级别
+		name string
+		// sink 不做级别过滤，caolog 判断过级别后通过它输出，以便请求级别与飞行记录输出低于配置级别的日志；
+		// sinkFor 是设置 sink 时的 Logger，Logger 被替换后不再使用 sink
+		sink    *zap.Logger
+		sinkFor *zap.Logger
 	}
 
+	// Details 来自对象池，只在本次日志调用期间有效；
+	// Option 需要在调用之后继续持有 Value 或 Fields 时必须自行拷贝
 	Details struct {
 		Level zapcore.Level `json:"level,omitempty"`
-		// 调用log的文件路径
+		// 调用log的文件路径，EnableCaller(false) 时为空
 		Path string `json:"path,omitempty"`
 		// Time holds the value of the "time" field.
 		Time time.Time `json:"time,omitempty"`
@@ -41,6 +47,22 @@ type (
 		Message string `json:"message,omitempty"`
 		// 内容列表
 		Value []interface{}
+		// 结构化字段，来自参数中的 zap.Field 或由 Option 追加
+		Fields []zap.Field `json:"-"`
+		// 由 Option 置为 true 时丢弃本条日志，后续 Option 不再执行
+		Drop bool `json:"-"`
+
+		// buf 用于格式化 Message，line 用于拼接控制台输出，只作为暂存缓冲
+		buf    []byte
+		line   []byte
+		values []interface{}
+		fields []zap.Field
+		// console 是控制台模式下与 Message 一起格式化的整行，Message 是它的后缀；
+		// Option 没有修改 Path 与 Message 时直接输出，不再拷贝一次
+		console     string
+		consolePath string
+		// 飞行记录中的编号
+		seq uint64
 	}
 )
 
@@ -56,22 +78,30 @@ const (
 
 func init() {
 	Level = DebugLevel
+	SetLevel(DebugLevel)
 	logger = &Logger{
-		Logger: zap.NewExample(),
+		Logger:  zap.NewExample(),
+		Options: []Option{ContextFields},
 	}
 }
 
 type Option func(ctx context.Context, details *Details)
 
+// Lazy 延迟计算的日志参数，只有日志需要输出时才会调用，
+// 用于开销较大的调试内容；开启飞行记录时被过滤的日志也会计算，以便保存到记录中
+type Lazy func() interface{}
+
 // InitLogger
 // level: debug,info,warn,error,panic,fatal
 func InitLogger(level zapcore.Level, options ...Option) {
-	Level = level
-	customLevelEncoder := func(level zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
-		enc.AppendString("[" + level.CapitalString() + "]")
-	}
+	encoder := newConsoleEncoder(consoleTimeLayout)
+	initLogger(level, encoder, false, options...)
+}
 
-	encoder := zapcore.NewConsoleEncoder(zapcore.EncoderConfig{
+// InitJSONLogger 与 InitLogger 相同，但以 JSON 格式输出，Path 与 Fields 作为独立字段
+// level: debug,info,warn,error,panic,fatal
+func InitJSONLogger(level zapcore.Level, options ...Option) {
+	encoder := zapcore.NewJSONEncoder(zapcore.EncoderConfig{
 		TimeKey:        "ts",
 		LevelKey:       "level",
 		NameKey:        "logger",
@@ -79,17 +109,24 @@ func InitLogger(level zapcore.Level, options ...Option) {
 		MessageKey:     "msg",
 		StacktraceKey:  "stacktrace",
 		LineEnding:     zapcore.DefaultLineEnding,
-		EncodeLevel:    customLevelEncoder,
-		EncodeTime:     zapcore.TimeEncoderOfLayout("[2006-01-02 - 15:04:05]"),
-		EncodeDuration: zapcore.SecondsDurationEncoder,
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeTime:     zapcore.RFC3339NanoTimeEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
 		EncodeCaller:   zapcore.ShortCallerEncoder,
 	})
-	core := zapcore.NewCore(encoder, os.Stdout, level)
+	initLogger(level, encoder, true, options...)
+}
+
+func initLogger(level zapcore.Level, encoder zapcore.Encoder, json bool, options ...Option) {
+	SetLevel(level)
+	// core 接受所有级别，Logger 按全局与按名称配置的级别过滤，caolog 判断过级别的日志通过 sink 输出
+	core := zapcore.NewCore(encoder, os.Stdout, zapcore.DebugLevel)
 
 	logger = &Logger{
-		Logger:  zap.New(core),
-		Options: make([]Option, 0),
+		Options: []Option{ContextFields},
+		JSON:    json,
 	}
+	logger.setSink(zap.New(core))
 	if len(options) > 0 {
 		logger.with(options...)
 	}
@@ -104,94 +141,24 @@ func GetWriter() io.Writer {
 }
 
 func getValue(v interface{}) string {
-	switch v.(type) {
-	case float64:
-		return strconv.FormatFloat(v.(float64), 'f', -1, 64)
-	case float32:
-		return strconv.FormatFloat(float64(v.(float32)), 'f', -1, 64)
-	case int:
-		//return FormatInt(int64(v.(int)))
-		return strconv.FormatInt(int64(v.(int)), 10)
-	case uint:
-		//return FormatUint(uint64(v.(uint)))
-		return strconv.FormatUint(uint64(v.(uint)), 10)
-	case int8:
-		//return FormatInt(int64(v.(int8)))
-		return strconv.FormatInt(int64(v.(int8)), 10)
-	case uint8:
-		//return FormatUint(uint64(v.(uint8)))
-		return strconv.FormatUint(uint64(v.(uint8)), 10)
-	case int16:
-		//return FormatInt(int64(v.(int16)))
-		return strconv.FormatInt(int64(v.(int16)), 10)
-	case uint16:
-		//return FormatUint(uint64(v.(uint16)))
-		return strconv.FormatUint(uint64(v.(uint16)), 10)
-	case int32:
-		//return FormatInt(int64(v.(int32)))
-		return strconv.FormatInt(int64(v.(int32)), 10)
-	case uint32:
-		//return FormatUint(uint64(v.(uint32)))
-		return strconv.FormatUint(uint64(v.(uint32)), 10)
-	case int64:
-		//return FormatInt(v.(int64))
-		return strconv.FormatInt(v.(int64), 10)
-	case uint64:
-		//return FormatUint(v.(uint64))
-		return strconv.FormatUint(v.(uint64), 10)
-	case string:
-		return v.(string)
-	case []byte:
-		return string(v.([]byte))
-	case error:
-		return v.(error).Error()
-	//case []int32:
-	//	return FormatBufferPool(v)
-	default:
-		//newValue, err := json.Marshal(v)
-		newValue, err := sonic.Marshal(&v)
-		if err != nil {
-			return "Log Format Error:" + err.Error()
-		}
-		return *(*string)(unsafe.Pointer(&newValue))
-	}
+	return string(appendValue(nil, v))
 }
 
 func FormatBufferPool[t any](value ...t) string {
-	if value == nil {
+	if len(value) == 0 {
 		return ""
 	}
-	bufferLen := 0
-
-	cache := make([]string, 0, len(value))
-	for index, v := range value {
-		cache = append(cache, getValue(v))
-		bufferLen += len(cache[index])
+	buf := bufferPool.Get().(*[]byte)
+	for _, v := range value {
+		*buf = appendValue(*buf, v)
+		*buf = append(*buf, tabByte)
 	}
-
-	builder := strings.Builder{}
-	builder.Grow(bufferLen + len(value) - 1)
-	for index, v := range cache {
-		builder.WriteString(v)
-		if index <= len(value)-1 {
-			builder.WriteString("\t")
-			//builder.Write([]byte{tabByte})
-		}
+	msg := string(*buf)
+	if cap(*buf) <= maxPooledBuffer {
+		*buf = (*buf)[:0]
+		bufferPool.Put(buf)
 	}
-
-	//msgBytes := make([]byte, bufferLen+len(value)-1)
-	//flagNum := 0
-	//for i, s := range cache {
-	//	copy(msgBytes[flagNum:], s)
-	//	flagNum += len(s)
-	//	if i < len(cache)-1 {
-	//		msgBytes[flagNum] = tabByte
-	//		flagNum++
-	//	}
-	//}
-
-	return builder.String()
-	//return *(*string)(unsafe.Pointer(&msgBytes))
+	return msg
 }
 
 func PenultimateIndexByteString(s string, c byte) int {
@@ -212,26 +179,11 @@ func PenultimateIndexByteString(s string, c byte) int {
 //	return logger.makeDetails(deep, level, value...)
 //}
 
-// makeDetails
-func (l *Logger) makeDetails(deep int, level zapcore.Level, value ...interface{}) Details {
-	_, file, line, _ := runtime.Caller(deep)
-
-	file = file[PenultimateIndexByteString(file, '/')+1:]
-	lineStr := FormatInt(int64(line))
-
-	msgBytes := make([]byte, len(file)+len(lineStr)+1)
-	copy(msgBytes, file)
-	msgBytes[len(file)] = ':'
-	copy(msgBytes[len(file)+1:], lineStr)
-	fileLine := *(*string)(unsafe.Pointer(&msgBytes))
-
-	return Details{
-		Level:   level,
-		Path:    fileLine,
-		Time:    time.Now(),
-		Message: FormatBufferPool(value...),
-		Value:   value,
-	}
+// makeDetails 返回的 Details 使用完毕后需要调用 putDetails 放回对象池
+func (l *Logger) makeDetails(deep int, level zapcore.Level, value ...interface{}) *Details {
+	detail := getDetails()
+	detail.fill(level, callerPath(deep), value, !l.JSON)
+	return detail
 }
 
 type output func(msg string, fields ...zap.Field)
@@ -245,73 +197,128 @@ func (l *Logger) with(options ...Option) {
 	l.Options = append(l.Options, options...)
 }
 
+// Child 返回追加了 options 的子 Logger，不影响 l 本身
+func (l *Logger) Child(options ...Option) *Logger {
+	child := *l
+	child.Options = make([]Option, 0, len(l.Options)+len(options))
+	child.Options = append(child.Options, l.Options...)
+	child.Options = append(child.Options, options...)
+	return &child
+}
+
 func (l *Logger) withSpan(c context.Context, deep int, level zapcore.Level, output output, value ...interface{}) {
 
 	// 构建日志详情结构体
 	detail := l.makeDetails(deep, level, value...)
+	defer putDetails(detail)
+	if !l.apply(c, detail) {
+		return
+	}
+	if level >= ErrorLevel {
+		// 先输出飞行记录中的上下文，再输出错误本身
+		l.dumpFlightRecorder(c)
+	}
+	l.write(detail, output)
+}
+
+// apply 依次执行 Options，某个 Option 丢弃日志时返回 false
+func (l *Logger) apply(c context.Context, detail *Details) bool {
 	// 遍历options，执行option
 	for _, option := range l.Options {
-		option(c, &detail)
+		option(c, detail)
+		if detail.Drop {
+			return false
+		}
 	}
+	return true
+}
 
-	// 从buffer池中获取buffer，用于拼接日志详情
-	builder := strings.Builder{}
-	builder.Grow(max(30, len(detail.Path)+len(detail.Message)+1))
+// write 按输出格式拼接并输出日志详情
+func (l *Logger) write(detail *Details, output output) {
+	if l.JSON {
+		if detail.Path != "" {
+			detail.Fields = append(detail.Fields, zap.String("path", detail.Path))
+		}
+		output(detail.Message, detail.Fields...)
+		return
+	}
+	if detail.Path == "" {
+		output(detail.Message, detail.Fields...)
+		return
+	}
 
-	builder.WriteString(detail.Path)
-	for builder.Len() < 30 {
-		builder.WriteByte(' ')
+	if prefix := len(detail.console) - len(detail.Message); prefix > 0 && detail.Path == detail.consolePath &&
+		detail.console[prefix:] == detail.Message {
+		output(detail.console, detail.Fields...)
+		return
 	}
-	builder.WriteString(detail.Message)
 
-	output(builder.String())
-	//_ = builder.String()
-	//println(builder.Len())
+	// Option 修改过内容时在 detail 自带的缓冲中重新拼接，拷贝后再交给 zap
+	line := appendPath(detail.line[:0], detail.Path)
+	line = append(line, detail.Message...)
+	detail.line = line
 
+	output(string(line), detail.Fields...)
+}
+
+// appendPath 追加调用位置，不足 30 字节时以空格补齐
+func appendPath(buf []byte, path string) []byte {
+	start := len(buf)
+	buf = append(buf, path...)
+	for len(buf)-start < 30 {
+		buf = append(buf, ' ')
+	}
+	return buf
 }
 
 func (l *Logger) CDebug(c context.Context, deep int, args ...interface{}) {
-	if Level > DebugLevel {
+	if !l.enabled(c, DebugLevel) {
+		l.record(c, deep, DebugLevel, args...)
 		return
 	}
-	l.withSpan(c, deep, DebugLevel, l.Logger.Debug, args...)
+	l.withSpan(c, deep, DebugLevel, l.sinkLogger().Debug, args...)
 }
 func (l *Logger) CInfo(c context.Context, deep int, args ...interface{}) {
-	if Level > InfoLevel {
+	if !l.enabled(c, InfoLevel) {
+		l.record(c, deep, InfoLevel, args...)
 		return
 	}
-	l.withSpan(c, deep, InfoLevel, l.Logger.Info, args...)
+	l.withSpan(c, deep, InfoLevel, l.sinkLogger().Info, args...)
 }
 func (l *Logger) CWarn(c context.Context, deep int, args ...interface{}) {
-	if Level > WarnLevel {
+	if !l.enabled(c, WarnLevel) {
+		l.record(c, deep, WarnLevel, args...)
 		return
 	}
-	l.withSpan(c, deep, WarnLevel, l.Logger.Warn, args...)
+	l.withSpan(c, deep, WarnLevel, l.sinkLogger().Warn, args...)
 }
 func (l *Logger) CError(c context.Context, deep int, args ...interface{}) {
-	if Level > ErrorLevel {
+	if !l.enabled(c, ErrorLevel) {
+		l.record(c, deep, ErrorLevel, args...)
 		return
 	}
-	l.withSpan(c, deep, ErrorLevel, l.Logger.Error, args...)
+	l.withSpan(c, deep, ErrorLevel, l.sinkLogger().Error, args...)
 }
 func (l *Logger) CDPanic(c context.Context, deep int, args ...interface{}) {
-	if Level > DPanicLevel {
+	if !l.enabled(c, DPanicLevel) {
+		l.record(c, deep, DPanicLevel, args...)
 		return
 	}
-	l.withSpan(c, deep, DPanicLevel, l.Logger.DPanic, args...)
+	l.withSpan(c, deep, DPanicLevel, l.sinkLogger().DPanic, args...)
 }
 func (l *Logger) CPanic(c context.Context, deep int, args ...interface{}) {
-	if Level > PanicLevel {
+	if !l.enabled(c, PanicLevel) {
+		l.record(c, deep, PanicLevel, args...)
 		return
 	}
-	l.withSpan(c, deep, PanicLevel, l.Logger.Panic, args...)
+	l.withSpan(c, deep, PanicLevel, l.sinkLogger().Panic, args...)
 }
 func (l *Logger) CFatal(c context.Context, deep int, args ...interface{}) {
-	l.withSpan(c, deep, FatalLevel, l.Logger.Fatal, args...)
+	l.withSpan(c, deep, FatalLevel, l.sinkLogger().Fatal, args...)
 }
 
 func (l *Logger) Debug(deep int, args ...interface{}) {
-	l.CDebug(context.Background(), deep, args)
+	l.CDebug(context.Background(), deep, args...)
 }
 func (l *Logger) Info(deep int, args ...interface{}) {
 	l.CInfo(context.Background(), deep, args...)
@@ -333,45 +340,45 @@ func (l *Logger) Fatal(deep int, args ...interface{}) {
 }
 
 func CDebug(c context.Context, args ...interface{}) {
-	logger.CDebug(c, logDeep, args...)
+	FromContext(c).CDebug(c, AutoDeep, args...)
 }
 func CInfo(c context.Context, args ...interface{}) {
-	logger.CInfo(c, logDeep, args...)
+	FromContext(c).CInfo(c, AutoDeep, args...)
 }
 func CWarn(c context.Context, args ...interface{}) {
-	logger.CWarn(c, logDeep, args...)
+	FromContext(c).CWarn(c, AutoDeep, args...)
 }
 func CError(c context.Context, args ...interface{}) {
-	logger.CError(c, logDeep, args...)
+	FromContext(c).CError(c, AutoDeep, args...)
 }
 func CPanic(c context.Context, args ...interface{}) {
-	logger.CPanic(c, logDeep, args...)
+	FromContext(c).CPanic(c, AutoDeep, args...)
 }
 func CDPanic(c context.Context, args ...interface{}) {
-	logger.CDPanic(c, logDeep, args...)
+	FromContext(c).CDPanic(c, AutoDeep, args...)
 }
 func CFatal(c context.Context, args ...interface{}) {
-	logger.CFatal(c, logDeep, args...)
+	FromContext(c).CFatal(c, AutoDeep, args...)
 }
 
 func Debug(args ...interface{}) {
-	logger.CDebug(context.Background(), logDeep, args...)
+	logger.CDebug(context.Background(), AutoDeep, args...)
 }
 func Info(args ...interface{}) {
-	logger.CInfo(context.Background(), logDeep, args...)
+	logger.CInfo(context.Background(), AutoDeep, args...)
 }
 func Warn(args ...interface{}) {
-	logger.CWarn(context.Background(), logDeep, args...)
+	logger.CWarn(context.Background(), AutoDeep, args...)
 }
 func Error(args ...interface{}) {
-	logger.CError(context.Background(), logDeep, args...)
+	logger.CError(context.Background(), AutoDeep, args...)
 }
 func Panic(args ...interface{}) {
-	logger.CPanic(context.Background(), logDeep, args...)
+	logger.CPanic(context.Background(), AutoDeep, args...)
 }
 func DPanic(args ...interface{}) {
-	logger.CDPanic(context.Background(), logDeep, args...)
+	logger.CDPanic(context.Background(), AutoDeep, args...)
 }
 func Fatal(args ...interface{}) {
-	logger.CFatal(context.Background(), logDeep, args...)
+	logger.CFatal(context.Background(), AutoDeep, args...)
 }
@@ -2,98 +2,181 @@ package plugin
 
 import (
 	"context"
-	"fmt"
 	caolog "github.com/CaoStudio/caolog"
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
 	"go.uber.org/zap"
-	"net"
+	"net/http"
 	"os"
-	"runtime/debug"
-	"strings"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
 )
 
-type Recovery struct {
-	logger caolog.Logger
-	deep   int
-}
+type (
+	Recovery struct {
+		logger   caolog.Logger
+		deep     int
+		hooks    []RecoveryHook
+		repanic  bool
+		crashDir string
+	}
+
+	// RecoveryHook 在 panic 日志记录之后调用，可用于告警
+	RecoveryHook func(ctx context.Context, report *PanicReport)
+)
 
 // NewRecovery returns a new recovery plugin.
 func NewRecovery(caologger caolog.Logger) *Recovery {
 	return &Recovery{
 		logger: caologger,
-		deep:   4,
+		deep:   caolog.AutoDeep,
 	}
 }
 
-// WithDeep with recovery deep.
+// WithDeep with recovery deep, the default caolog.AutoDeep logs the panicking function.
 func (r *Recovery) WithDeep(deep int) {
 	r.deep = deep
 }
 
+// WithHook appends hooks called with the report of every recovered panic.
+func (r *Recovery) WithHook(hooks ...RecoveryHook) {
+	r.hooks = append(r.hooks, hooks...)
+}
+
+// WithRepanic panics again with the original value after logging, useful in tests.
+func (r *Recovery) WithRepanic(repanic bool) {
+	r.repanic = repanic
+}
+
+// WithCrashDir writes a dump of all goroutines to a timestamped file in dir for every recovered panic.
+func (r *Recovery) WithCrashDir(dir string) {
+	r.crashDir = dir
+}
+
 // Recovery recover掉项目可能出现的panic，并使用zap记录相关日志
 func (r *Recovery) Recovery() {
 	if err := recover(); err != nil {
-		// Check for a broken connection, as it is not really a
-		// condition that warrants a panic stack trace.
-		var brokenPipe bool
-		if ne, ok := err.(*net.OpError); ok {
-			if se, ok := ne.Err.(*os.SyscallError); ok {
-				if strings.Contains(strings.ToLower(se.Error()), "broken pipe") || strings.Contains(strings.ToLower(se.Error()), "connection reset by peer") {
-					brokenPipe = true
-				}
-			}
-		}
-		if brokenPipe {
-			r.logger.Logger.Error(
-				fmt.Sprintln(
-					zap.Any("error", err),
-				),
-			)
-			// If the connection is dead, we can't write a status to it.
-			return
-		}
-
-		r.logger.Error(
-			r.deep,
-			fmt.Sprintln(
-				"[Recovery from panic]\n",
-				zap.Any("error", err).String,
-				zap.String("stack", string(debug.Stack())).String,
-			),
-		)
+		r.handle(context.Background(), err)
 	}
 }
 
 // CRecovery recover掉项目可能出现的panic，并使用zap记录相关日志
+//
+// Deprecated: 与 Recovery 相同，需要记录 ctx 信息时使用 RecoveryContext。
 func (r *Recovery) CRecovery() {
 	if err := recover(); err != nil {
-		// Check for a broken connection, as it is not really a
-		// condition that warrants a panic stack trace.
-		var brokenPipe bool
-		if ne, ok := err.(*net.OpError); ok {
-			if se, ok := ne.Err.(*os.SyscallError); ok {
-				if strings.Contains(strings.ToLower(se.Error()), "broken pipe") || strings.Contains(strings.ToLower(se.Error()), "connection reset by peer") {
-					brokenPipe = true
+		r.handle(context.Background(), err)
+	}
+}
+
+// RecoveryContext recover掉项目可能出现的panic，并使用zap记录带有ctx信息的日志
+func (r *Recovery) RecoveryContext(ctx context.Context) {
+	if err := recover(); err != nil {
+		r.handle(ctx, err)
+	}
+}
+
+// HTTP is a net/http middleware, it recovers the panic of next and replies 500.
+func (r *Recovery) HTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				// http.ErrAbortHandler 用于主动中断响应，交还给 net/http 处理
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				if r.handle(req.Context(), err) {
+					w.WriteHeader(http.StatusInternalServerError)
 				}
 			}
+		}()
+		next.ServeHTTP(w, req)
+	})
+}
+
+// Kratos is a kratos middleware, it converts the panic into an internal server error.
+func (r *Recovery) Kratos() middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			defer func() {
+				if rerr := recover(); rerr != nil {
+					r.handle(ctx, rerr)
+					// panic 的值可能含有内部信息，只记录在日志与报告中，不返回给调用方
+					err = errors.InternalServer("RECOVERY", "unknown request error")
+				}
+			}()
+			return handler(ctx, req)
 		}
-		if brokenPipe {
-			r.logger.Logger.Error(
-				fmt.Sprintln(
-					zap.Any("error", err),
-				),
-			)
-			// If the connection is dead, we can't write a status to it.
-			return
+	}
+}
+
+// Go runs fn in a new goroutine with ctx, the panic of fn is recovered and logged with ctx.
+func (r *Recovery) Go(ctx context.Context, fn func(ctx context.Context)) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				r.handle(ctx, err)
+			}
+		}()
+		fn(ctx)
+	}()
+}
+
+// handle 记录 panic 日志，返回连接是否仍然可以写入响应
+func (r *Recovery) handle(ctx context.Context, err interface{}) bool {
+	// Check for a broken connection, as it is not really a
+	// condition that warrants a panic stack trace.
+	if e, ok := err.(error); ok && (errors.Is(e, syscall.EPIPE) || errors.Is(e, syscall.ECONNRESET)) {
+		r.logger.CError(ctx, r.deep, "[Recovery from broken connection]", e)
+		// If the connection is dead, we can't write a status to it.
+		return false
+	}
+
+	// error 级别的日志会先输出当前 goroutine 或 trace 的飞行记录
+	report := NewPanicReport(err)
+	if r.logger.JSON {
+		r.logger.CError(ctx, r.deep, "[Recovery from panic]", zap.Object("panic", report))
+	} else {
+		r.logger.CError(ctx, r.deep, "[Recovery from panic]\n"+report.String())
+	}
+	if r.crashDir != "" {
+		if path, werr := r.writeCrash(report); werr != nil {
+			r.logger.CError(ctx, r.deep, "[Recovery] write crash file failed", werr)
+		} else {
+			r.logger.CError(ctx, r.deep, "[Recovery] crash file", path)
+		}
+	}
+	for _, hook := range r.hooks {
+		hook(ctx, report)
+	}
+	if r.repanic {
+		panic(err)
+	}
+	return true
+}
+
+// writeCrash 将 panic 报告与所有 goroutine 的调用栈写入 crashDir 下的文件
+func (r *Recovery) writeCrash(report *PanicReport) (string, error) {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
 		}
+		buf = make([]byte, len(buf)*2)
+	}
 
-		r.logger.CError(
-			context.Background(),
-			r.deep,
-			fmt.Sprintln(
-				"[Recovery from panic]\n",
-				zap.Any("error", err).String,
-				zap.String("stack", string(debug.Stack())).String,
-			),
-		)
+	if err := os.MkdirAll(r.crashDir, 0o755); err != nil {
+		return "", err
 	}
+	name := "crash-" + time.Now().Format("20060102-150405.000000000") + "-" + report.Fingerprint + ".log"
+	path := filepath.Join(r.crashDir, name)
+	content := make([]byte, 0, len(buf)+1024)
+	content = append(content, report.String()...)
+	content = append(content, "\n\n"...)
+	content = append(content, buf...)
+	return path, os.WriteFile(path, content, 0o644)
 }
@@ -0,0 +1,134 @@
+package plugin_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/CaoStudio/caolog/internal/caologtest"
+	"github.com/CaoStudio/caolog/plugin"
+	"github.com/go-kratos/kratos/v2/errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestRecoveryHTTP(t *testing.T) {
+	buf := &bytes.Buffer{}
+	recovery := plugin.NewRecovery(*caologtest.NewBufferLogger(buf))
+	handler := recovery.HTTP(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+	if !strings.Contains(buf.String(), "Recovery from panic") {
+		t.Fatalf("panic not logged: %q", buf.String())
+	}
+}
+
+func TestRecoveryKratos(t *testing.T) {
+	recovery := plugin.NewRecovery(*caologtest.NewBufferLogger(&bytes.Buffer{}))
+	handler := recovery.Kratos()(func(context.Context, interface{}) (interface{}, error) {
+		panic("boom")
+	})
+	_, err := handler(context.Background(), nil)
+	if !errors.IsInternalServer(err) || strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expected internal server error without the panic value, got %v", err)
+	}
+}
+
+func TestRecoveryGoContext(t *testing.T) {
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "request-1")
+	recovery := plugin.NewRecovery(*caologtest.NewBufferLogger(&bytes.Buffer{}))
+	seen := make(chan interface{}, 2)
+	recovery.WithHook(func(ctx context.Context, _ *plugin.PanicReport) {
+		seen <- ctx.Value(key{})
+	})
+
+	recovery.Go(ctx, func(ctx context.Context) {
+		seen <- ctx.Value(key{})
+		panic("boom")
+	})
+	for _, from := range []string{"fn", "hook"} {
+		if v := <-seen; v != "request-1" {
+			t.Fatalf("%s should receive the ctx passed to Go, got %v", from, v)
+		}
+	}
+}
+
+func TestPanicReport(t *testing.T) {
+	var report *plugin.PanicReport
+	func() {
+		defer func() {
+			report = plugin.NewPanicReport(recover())
+		}()
+		var m map[string]int
+		m["boom"]++
+	}()
+
+	if !strings.HasPrefix(report.Type, "runtime.") {
+		t.Fatalf("unexpected type %q", report.Type)
+	}
+	if len(report.Frames) == 0 || !strings.Contains(report.Frames[0].Function, "TestPanicReport") {
+		t.Fatalf("runtime and caolog frames should be trimmed, got %+v", report.Frames)
+	}
+	if report.GoroutineID == 0 || report.Fingerprint == "" {
+		t.Fatalf("missing goroutine or fingerprint: %+v", report)
+	}
+}
+
+func TestRecoveryHooks(t *testing.T) {
+	dir := t.TempDir()
+	recovery := plugin.NewRecovery(*caologtest.NewBufferLogger(&bytes.Buffer{}))
+	recovery.WithCrashDir(dir)
+	reports := make(chan *plugin.PanicReport, 1)
+	recovery.WithHook(func(_ context.Context, report *plugin.PanicReport) {
+		reports <- report
+	})
+
+	recovery.Go(context.Background(), func(context.Context) {
+		panic("boom")
+	})
+	report := <-reports
+	if report.Error() != "boom" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one crash file, got %v %v", files, err)
+	}
+
+	repanic := plugin.NewRecovery(*caologtest.NewBufferLogger(&bytes.Buffer{}))
+	repanic.WithRepanic(true)
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected repanic")
+		}
+	}()
+	func() {
+		defer repanic.Recovery()
+		panic("again")
+	}()
+}
+
+func TestRecoveryBrokenPipe(t *testing.T) {
+	buf := &bytes.Buffer{}
+	recovery := plugin.NewRecovery(*caologtest.NewBufferLogger(buf))
+	recovery.WithHook(func(context.Context, *plugin.PanicReport) {
+		t.Fatalf("broken connections should not trigger hooks")
+	})
+	func() {
+		defer recovery.Recovery()
+		panic(&net.OpError{Op: "write", Err: os.NewSyscallError("write", syscall.EPIPE)})
+	}()
+	if !strings.Contains(buf.String(), "broken connection") {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+}
@@ -0,0 +1,143 @@
+package plugin
+
+import (
+	"fmt"
+	"github.com/CaoStudio/caolog/internal/callers"
+	"github.com/CaoStudio/caolog/internal/goroutine"
+	"go.uber.org/zap/zapcore"
+	"hash/fnv"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// fingerprintFrames 参与计算指纹的栈帧数量
+const fingerprintFrames = 5
+
+type (
+	// PanicReport 一次 panic 的结构化信息
+	PanicReport struct {
+		// panic 的值
+		Value interface{}
+		// panic 值的类型
+		Type string
+		// 裁剪掉 runtime 与 caolog 之后的调用栈，从 panic 发生处开始
+		Frames []Frame
+		// 发生 panic 的 goroutine
+		GoroutineID uint64
+		// 由 panic 类型与栈顶函数计算，同一处 panic 的指纹保持不变
+		Fingerprint string
+	}
+
+	// Frame 调用栈中的一帧
+	Frame struct {
+		Function string
+		File     string
+		Line     int
+	}
+)
+
+// NewPanicReport builds the report of the recovered value, it must be called in the panicking goroutine.
+func NewPanicReport(value interface{}) *PanicReport {
+	report := &PanicReport{
+		Value:       value,
+		Type:        fmt.Sprintf("%T", value),
+		GoroutineID: goroutine.ID(),
+	}
+
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(1, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !trimFrame(frame.Function) {
+			report.Frames = append(report.Frames, Frame{
+				Function: frame.Function,
+				File:     frame.File,
+				Line:     frame.Line,
+			})
+		}
+		if !more {
+			break
+		}
+	}
+	report.Fingerprint = report.fingerprint()
+	return report
+}
+
+// Error returns the panic value as a string.
+func (p *PanicReport) Error() string {
+	if err, ok := p.Value.(error); ok {
+		return err.Error()
+	}
+	return fmt.Sprint(p.Value)
+}
+
+// String 可读格式，用于控制台输出
+func (p *PanicReport) String() string {
+	builder := strings.Builder{}
+	builder.WriteString(p.Type)
+	builder.WriteString(": ")
+	builder.WriteString(p.Error())
+	builder.WriteString("\ngoroutine ")
+	builder.WriteString(strconv.FormatUint(p.GoroutineID, 10))
+	builder.WriteString(" [")
+	builder.WriteString(p.Fingerprint)
+	builder.WriteString("]")
+	for _, frame := range p.Frames {
+		builder.WriteString("\n")
+		builder.WriteString(frame.Function)
+		builder.WriteString("\n\t")
+		builder.WriteString(frame.File)
+		builder.WriteString(":")
+		builder.WriteString(strconv.Itoa(frame.Line))
+	}
+	return builder.String()
+}
+
+// MarshalLogObject 结构化格式，用于 JSON 输出
+func (p *PanicReport) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("error", p.Error())
+	enc.AddString("type", p.Type)
+	enc.AddUint64("goroutine", p.GoroutineID)
+	enc.AddString("fingerprint", p.Fingerprint)
+	return enc.AddArray("frames", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+		for _, frame := range p.Frames {
+			if err := arr.AppendObject(frame); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func (f Frame) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("function", f.Function)
+	enc.AddString("file", f.File)
+	enc.AddInt("line", f.Line)
+	return nil
+}
+
+// fingerprint 使用函数名而不是行号，代码的无关改动不会改变指纹
+func (p *PanicReport) fingerprint() string {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(p.Type))
+	for i, frame := range p.Frames {
+		if i >= fingerprintFrames {
+			break
+		}
+		_, _ = hash.Write([]byte{'\n'})
+		_, _ = hash.Write([]byte(frame.Function))
+	}
+	return strconv.FormatUint(hash.Sum64(), 16)
+}
+
+// trimFrame 判断栈帧是否属于 runtime 或 caolog
+func trimFrame(function string) bool {
+	pkg := callers.FuncPackage(function)
+	for _, trim := range callers.Packages {
+		if pkg == trim {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package plugin
+
+import (
+	"context"
+	"encoding/binary"
+	caolog "github.com/CaoStudio/caolog"
+	"go.uber.org/zap/zapcore"
+	"sync/atomic"
+)
+
+// Sampler 按 traceID 对一次请求的日志整体采样：被采样的请求保留全部日志，未被采样的请求丢弃 error 以下的日志
+type Sampler struct {
+	// bound 与 traceID 后 8 字节右移一位后的值比较，算法与 otel 的 TraceIDRatioBased 一致
+	bound       atomic.Uint64
+	sampledFlag atomic.Bool
+}
+
+// NewSampler returns a new sampler plugin keeping the given ratio of requests.
+func NewSampler(rate float64) *Sampler {
+	s := &Sampler{}
+	s.SetRate(rate)
+	return s
+}
+
+// SetRate sets the ratio of requests whose logs are kept, rate is clamped to [0, 1].
+func (s *Sampler) SetRate(rate float64) {
+	switch {
+	case rate >= 1:
+		s.bound.Store(1 << 63)
+	case rate <= 0:
+		s.bound.Store(0)
+	default:
+		s.bound.Store(uint64(rate * (1 << 63)))
+	}
+}
+
+// Rate returns the current sampling rate.
+func (s *Sampler) Rate() float64 {
+	return float64(s.bound.Load()) / (1 << 63)
+}
+
+// WithSampledFlag uses the otel sampled flag of the span instead of the traceID hash.
+func (s *Sampler) WithSampledFlag(enable bool) {
+	s.sampledFlag.Store(enable)
+}
+
+func (s *Sampler) Option(ctx context.Context, details *caolog.Details) {
+	if details.Level >= zapcore.ErrorLevel {
+		return
+	}
+	spanCtx, ok := spanContext(ctx)
+	if !ok {
+		// 没有 trace 信息时无法保证一致性，全部保留
+		return
+	}
+	if s.sampledFlag.Load() {
+		details.Drop = !spanCtx.IsSampled()
+		return
+	}
+	traceID := spanCtx.TraceID()
+	details.Drop = binary.BigEndian.Uint64(traceID[8:16])>>1 >= s.bound.Load()
+}
@@ -0,0 +1,45 @@
+package plugin_test
+
+import (
+	"context"
+	caolog "github.com/CaoStudio/caolog"
+	"github.com/CaoStudio/caolog/plugin"
+	"go.opentelemetry.io/otel/trace"
+	"testing"
+)
+
+func TestSamplerConsistent(t *testing.T) {
+	sampler := plugin.NewSampler(0.5)
+	kept := 0
+	for n := 0; n < 256; n++ {
+		var traceID trace.TraceID
+		traceID[15] = byte(n)
+		traceID[8] = byte(n)
+		ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID}))
+
+		info := &caolog.Details{Level: caolog.InfoLevel}
+		sampler.Option(ctx, info)
+		debug := &caolog.Details{Level: caolog.DebugLevel}
+		sampler.Option(ctx, debug)
+		if info.Drop != debug.Drop {
+			t.Fatalf("trace %s sampled inconsistently", traceID)
+		}
+		errDetails := &caolog.Details{Level: caolog.ErrorLevel}
+		sampler.Option(ctx, errDetails)
+		if errDetails.Drop {
+			t.Fatalf("error logs must never be dropped")
+		}
+		if !info.Drop {
+			kept++
+		}
+	}
+	if kept == 0 || kept == 256 {
+		t.Fatalf("expected about half of the traces to be kept, got %d", kept)
+	}
+
+	noTrace := &caolog.Details{Level: caolog.DebugLevel}
+	sampler.Option(context.Background(), noTrace)
+	if noTrace.Drop {
+		t.Fatalf("logs without trace must be kept")
+	}
+}
@@ -0,0 +1,256 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	caolog "github.com/CaoStudio/caolog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"regexp"
+	"strings"
+)
+
+// defaultMask 替换敏感内容的文本
+const defaultMask = "******"
+
+// fieldEncoder 将结构体、ObjectMarshaler 等字段编码为 JSON 文本，以便查找其中的敏感内容
+var fieldEncoder = zapcore.NewJSONEncoder(zapcore.EncoderConfig{
+	EncodeDuration: zapcore.StringDurationEncoder,
+	EncodeTime:     zapcore.RFC3339NanoTimeEncoder,
+	SkipLineEnding: true,
+})
+
+type (
+	// Scrubber 在日志输出之前查找并遮盖 Message、字符串参数与字段中的敏感内容，
+	// error、Stringer、结构体等字段先转换为文本，有内容被遮盖时以字符串字段输出；
+	// 需要放在 Trace 等读取 Message 的 Option 之前
+	Scrubber struct {
+		detectors []detector
+		mask      string
+	}
+
+	detector struct {
+		name string
+		re   *regexp.Regexp
+		// replace 返回匹配内容的替换文本，ok 为 false 时保留原文，如校验位不通过
+		replace func(match, mask string) (string, bool)
+	}
+)
+
+// 内置检测器，按顺序执行：身份证号与带 86 前缀的手机号在银行卡号之前，避免被当作卡号
+var builtinDetectors = []detector{
+	{
+		name:    "jwt",
+		re:      regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+		replace: maskAll,
+	},
+	{
+		name: "bearer",
+		re:   regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`),
+		replace: func(match, mask string) (string, bool) {
+			// 保留 "Bearer " 前缀，便于排查认证方式
+			i := strings.IndexAny(match, " \t")
+			return match[:i+1] + mask, true
+		},
+	},
+	{
+		name:    "email",
+		re:      regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		replace: maskAll,
+	},
+	{
+		name: "idcard",
+		re:   regexp.MustCompile(`\b[1-9]\d{5}(?:18|19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b`),
+		replace: func(match, mask string) (string, bool) {
+			return mask, validIDCard(match)
+		},
+	},
+	{
+		name:    "phone",
+		re:      regexp.MustCompile(`(?:\+?\b86[- ]?|\b)1[3-9]\d{9}\b`),
+		replace: maskAll,
+	},
+	{
+		name: "card",
+		re:   regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		replace: func(match, mask string) (string, bool) {
+			return mask, luhn(match)
+		},
+	},
+}
+
+// NewScrubber returns a new scrubber plugin with the built-in detectors: JWTs, bearer tokens, emails,
+// Chinese mainland ID card numbers, credit card numbers passing the Luhn check and Chinese mobile numbers.
+func NewScrubber() *Scrubber {
+	return &Scrubber{
+		detectors: append([]detector(nil), builtinDetectors...),
+		mask:      defaultMask,
+	}
+}
+
+// WithPattern masks every match of re in addition to the built-in detectors.
+func (s *Scrubber) WithPattern(name string, re *regexp.Regexp) {
+	s.detectors = append(s.detectors, detector{name: name, re: re, replace: maskAll})
+}
+
+// WithoutDetectors disables the built-in detectors with the given names, such as "email" or "phone".
+func (s *Scrubber) WithoutDetectors(names ...string) {
+	detectors := s.detectors[:0]
+	for _, d := range s.detectors {
+		disabled := false
+		for _, name := range names {
+			disabled = disabled || d.name == name
+		}
+		if !disabled {
+			detectors = append(detectors, d)
+		}
+	}
+	s.detectors = detectors
+}
+
+// WithMask sets the text replacing sensitive data, "******" by default.
+func (s *Scrubber) WithMask(mask string) {
+	s.mask = mask
+}
+
+func (s *Scrubber) Option(ctx context.Context, details *caolog.Details) {
+	if scrubbed, ok := s.scrub(details.Message); ok {
+		details.Message = scrubbed
+	}
+
+	// Value 可能是调用方的切片，有改动时才复制
+	copied := false
+	for i, v := range details.Value {
+		str, isString := v.(string)
+		if !isString {
+			continue
+		}
+		if scrubbed, ok := s.scrub(str); ok {
+			if !copied {
+				details.Value = append([]interface{}(nil), details.Value...)
+				copied = true
+			}
+			details.Value[i] = scrubbed
+		}
+	}
+
+	for i, field := range details.Fields {
+		text, ok := fieldText(field)
+		if !ok {
+			continue
+		}
+		if scrubbed, ok := s.scrub(text); ok {
+			details.Fields[i] = zap.String(field.Key, scrubbed)
+		}
+	}
+}
+
+// fieldText 返回字段的文本，数字、时间等不会含有敏感内容的字段返回 false
+func fieldText(field zap.Field) (text string, ok bool) {
+	// 与 zap 相同，nil 指针的 Error、String 引发的 panic 不影响日志输出
+	defer func() {
+		if recover() != nil {
+			text, ok = "", false
+		}
+	}()
+	switch field.Type {
+	case zapcore.StringType:
+		return field.String, true
+	case zapcore.ByteStringType:
+		return string(field.Interface.([]byte)), true
+	case zapcore.ErrorType:
+		return field.Interface.(error).Error(), true
+	case zapcore.StringerType:
+		return field.Interface.(fmt.Stringer).String(), true
+	case zapcore.ReflectType, zapcore.ObjectMarshalerType, zapcore.ArrayMarshalerType:
+		field.Key = ""
+		buf, err := fieldEncoder.EncodeEntry(zapcore.Entry{}, []zapcore.Field{field})
+		if err != nil {
+			return "", false
+		}
+		defer buf.Free()
+		// 编码结果为 {"":value}
+		return string(buf.Bytes()[4 : buf.Len()-1]), true
+	}
+	return "", false
+}
+
+// Scrub returns text with all sensitive data masked.
+func (s *Scrubber) Scrub(text string) string {
+	scrubbed, _ := s.scrub(text)
+	return scrubbed
+}
+
+// scrub 依次执行检测器，ok 表示是否有内容被替换，没有替换时不分配内存
+func (s *Scrubber) scrub(text string) (string, bool) {
+	changed := false
+	for _, d := range s.detectors {
+		matches := d.re.FindAllStringIndex(text, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		builder := strings.Builder{}
+		builder.Grow(len(text))
+		last := 0
+		for _, m := range matches {
+			replaced, ok := d.replace(text[m[0]:m[1]], s.mask)
+			if !ok {
+				continue
+			}
+			builder.WriteString(text[last:m[0]])
+			builder.WriteString(replaced)
+			last = m[1]
+		}
+		if last == 0 {
+			continue
+		}
+		builder.WriteString(text[last:])
+		text = builder.String()
+		changed = true
+	}
+	return text, changed
+}
+
+func maskAll(_, mask string) (string, bool) {
+	return mask, true
+}
+
+// luhn 校验银行卡号，忽略空格与连字符
+func luhn(number string) bool {
+	sum, digits := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits >= 13 && sum%10 == 0
+}
+
+// idCardWeights 与 idCardChecks 是 GB 11643 规定的校验码算法
+var (
+	idCardWeights = [17]int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	idCardChecks  = "10X98765432"
+)
+
+// validIDCard 校验 18 位身份证号的最后一位
+func validIDCard(id string) bool {
+	sum := 0
+	for i, w := range idCardWeights {
+		sum += int(id[i]-'0') * w
+	}
+	check := id[17]
+	if check == 'x' {
+		check = 'X'
+	}
+	return idCardChecks[sum%11] == check
+}
@@ -0,0 +1,121 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	caolog "github.com/CaoStudio/caolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// sdkTracePackage 是调用 OnEnd 的 span.End 所在的包，输出调用位置时跳过，
+// 日志的调用位置指向结束 span 的代码
+const sdkTracePackage = "go.opentelemetry.io/otel/sdk/trace"
+
+// SpanLogger 是一个 sdktrace.SpanProcessor，在 span 结束时通过 caolog 输出一行日志
+type SpanLogger struct {
+	logger    *caolog.Logger
+	threshold time.Duration
+	statuses  []codes.Code
+	keys      []attribute.Key
+}
+
+var _ sdktrace.SpanProcessor = (*SpanLogger)(nil)
+
+// NewSpanLogger returns a new span logging processor.
+func NewSpanLogger(logger *caolog.Logger) *SpanLogger {
+	caolog.RegisterHelperPackage(sdkTracePackage)
+	return &SpanLogger{
+		logger: logger,
+	}
+}
+
+// WithThreshold only logs spans lasting at least d.
+func (s *SpanLogger) WithThreshold(d time.Duration) {
+	s.threshold = d
+}
+
+// WithStatus logs spans ending with one of the given statuses regardless of the threshold.
+func (s *SpanLogger) WithStatus(statuses ...codes.Code) {
+	s.statuses = statuses
+}
+
+// WithAttributes limits the logged attributes to the given keys, all attributes are logged by default.
+func (s *SpanLogger) WithAttributes(keys ...attribute.Key) {
+	s.keys = keys
+}
+
+func (s *SpanLogger) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (s *SpanLogger) OnEnd(span sdktrace.ReadOnlySpan) {
+	// Trace 插件为每条日志创建的 span 不再记录，否则会无限递归
+	if span.InstrumentationScope().Name == traceTracerName {
+		return
+	}
+	duration := span.EndTime().Sub(span.StartTime())
+	status := span.Status()
+	if !s.match(duration, status.Code) {
+		return
+	}
+
+	value := make([]interface{}, 0, len(span.Attributes())+1)
+	value = append(value, fmt.Sprintf("[Span] %12s | %5s | %s",
+		duration.String(),
+		status.Code.String(),
+		span.Name(),
+	))
+	if status.Description != "" {
+		value = append(value, status.Description)
+	}
+	for _, kv := range span.Attributes() {
+		if s.keep(kv.Key) {
+			value = append(value, string(kv.Key)+"="+kv.Value.Emit())
+		}
+	}
+
+	ctx := trace.ContextWithSpanContext(context.Background(), span.SpanContext())
+	switch {
+	case status.Code == codes.Error:
+		s.logger.CError(ctx, caolog.AutoDeep, value...)
+	case s.threshold > 0 && duration >= s.threshold:
+		s.logger.CWarn(ctx, caolog.AutoDeep, value...)
+	default:
+		s.logger.CInfo(ctx, caolog.AutoDeep, value...)
+	}
+}
+
+func (s *SpanLogger) Shutdown(context.Context) error {
+	return nil
+}
+
+func (s *SpanLogger) ForceFlush(context.Context) error {
+	return nil
+}
+
+// match 判断 span 是否需要记录：超过阈值或状态在列表中；两者均未配置时全部记录
+func (s *SpanLogger) match(duration time.Duration, code codes.Code) bool {
+	for _, status := range s.statuses {
+		if status == code {
+			return true
+		}
+	}
+	if s.threshold > 0 {
+		return duration >= s.threshold
+	}
+	return len(s.statuses) == 0
+}
+
+func (s *SpanLogger) keep(key attribute.Key) bool {
+	if len(s.keys) == 0 {
+		return true
+	}
+	for _, k := range s.keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
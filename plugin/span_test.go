@@ -0,0 +1,39 @@
+package plugin_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/CaoStudio/caolog/internal/caologtest"
+	"github.com/CaoStudio/caolog/plugin"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpanLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	spanLogger := plugin.NewSpanLogger(caologtest.NewBufferLogger(buf))
+	spanLogger.WithThreshold(time.Hour)
+	spanLogger.WithStatus(codes.Error)
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanLogger))
+	defer provider.Shutdown(context.Background())
+	tracer := provider.Tracer("test")
+
+	_, fast := tracer.Start(context.Background(), "fast")
+	fast.End()
+	if buf.Len() != 0 {
+		t.Fatalf("fast span should be filtered, got %q", buf.String())
+	}
+
+	_, failed := tracer.Start(context.Background(), "failed")
+	failed.SetStatus(codes.Error, "boom")
+	failed.End()
+	out := buf.String()
+	if !strings.Contains(out, "ERROR") || !strings.Contains(out, "failed") || !strings.Contains(out, "boom") ||
+		!strings.Contains(out, "span_test.go:") {
+		t.Fatalf("unexpected output %q", out)
+	}
+}
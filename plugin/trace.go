@@ -12,6 +12,9 @@ import (
 	"strings"
 )
 
+// traceTracerName 是 Trace 插件创建日志 span 时使用的 tracer 名称
+const traceTracerName = "log"
+
 type Trace struct {
 	tracerProvider trace.TracerProvider
 	tracer         trace.Tracer
@@ -22,7 +25,7 @@ func NewTrace() *Trace {
 	provider := otel.GetTracerProvider()
 	return &Trace{
 		tracerProvider: provider,
-		tracer:         provider.Tracer("log"),
+		tracer:         provider.Tracer(traceTracerName),
 	}
 }
 
@@ -55,13 +58,13 @@ func (t *Trace) GetLogTag(in zapcore.Level) string {
 }
 
 func (t *Trace) Option(ctx context.Context, details *caolog.Details) {
-	_, span := t.tracer.Start(ctx, t.GetLogTag(details.Level))
-	defer span.End()
-
-	spanCtx := trace.SpanContextFromContext(ctx)
-	if !spanCtx.HasTraceID() {
+	// 没有 trace 时不创建 span，也避免为每条日志分配 span
+	spanCtx, ok := spanContext(ctx)
+	if !ok {
 		return
 	}
+	_, span := t.tracer.Start(ctx, t.GetLogTag(details.Level))
+	defer span.End()
 
 	//traceMsg := caolog.FormatBufferPool(details.Value...)
 
@@ -86,3 +89,9 @@ func (t *Trace) Option(ctx context.Context, details *caolog.Details) {
 
 	span.SetAttributes(attrs...)
 }
+
+// spanContext 从 ctx 中取出携带 traceID 的 SpanContext
+func spanContext(ctx context.Context) (trace.SpanContext, bool) {
+	spanCtx := trace.SpanContextFromContext(ctx)
+	return spanCtx, spanCtx.HasTraceID()
+}
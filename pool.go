@@ -0,0 +1,109 @@
+package caolog
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"sync"
+	"time"
+)
+
+// maxPooledBuffer 超过该容量的缓冲不放回池中，避免偶发的大日志长期占用内存
+const maxPooledBuffer = 64 << 10
+
+var (
+	detailsPool = sync.Pool{New: func() interface{} {
+		return &Details{
+			buf:    make([]byte, 0, 256),
+			line:   make([]byte, 0, 256),
+			values: make([]interface{}, 0, 16),
+			fields: make([]zap.Field, 0, 8),
+		}
+	}}
+	bufferPool = sync.Pool{New: func() interface{} {
+		buf := make([]byte, 0, 256)
+		return &buf
+	}}
+)
+
+// getDetails 从池中取出日志详情，调用方结束后必须调用 putDetails
+func getDetails() *Details {
+	return detailsPool.Get().(*Details)
+}
+
+// putDetails 清空日志详情并放回池中，之后不能再访问它的 Message 与 Fields
+func putDetails(detail *Details) {
+	if cap(detail.buf) > maxPooledBuffer || cap(detail.line) > maxPooledBuffer {
+		return
+	}
+	clear(detail.values)
+	clear(detail.fields)
+	*detail = Details{
+		buf:    detail.buf[:0],
+		line:   detail.line[:0],
+		values: detail.values[:0],
+		fields: detail.fields[:0],
+	}
+	detailsPool.Put(detail)
+}
+
+// detach 返回可以在本次日志调用之后继续持有的拷贝
+func (d *Details) detach() Details {
+	return Details{
+		Level:   d.Level,
+		Path:    d.Path,
+		Time:    d.Time,
+		Message: d.Message,
+		Fields:  append([]zap.Field(nil), d.Fields...),
+
+		console:     d.console,
+		consolePath: d.consolePath,
+	}
+}
+
+// fill 将内容格式化到 detail 的缓冲中，再拷贝为 Message；
+// zap 的 core 可能持有 Entry，交给它的字符串不能引用会被复用的缓冲。
+// 控制台模式下调用位置与内容一起格式化，整行只拷贝一次，Message 是整行的后缀
+func (d *Details) fill(level zapcore.Level, path string, value []interface{}, console bool) {
+	d.Level = level
+	d.Path = path
+	d.Time = time.Now()
+	d.Value, d.Fields = d.splitFields(value)
+
+	if !console || path == "" {
+		d.buf = appendValues(d.buf[:0], d.Value)
+		d.Message = string(d.buf)
+		return
+	}
+	d.buf = appendPath(d.buf[:0], path)
+	prefix := len(d.buf)
+	d.buf = appendValues(d.buf, d.Value)
+	d.console = string(d.buf)
+	d.consolePath = path
+	d.Message = d.console[prefix:]
+}
+
+// splitFields 将参数中的 zap.Field 拆分为结构化字段，没有字段时直接使用原参数
+func (d *Details) splitFields(value []interface{}) ([]interface{}, []zap.Field) {
+	index := -1
+	for i, v := range value {
+		if _, ok := v.(zap.Field); ok {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return value, d.fields[:0]
+	}
+
+	values := append(d.values[:0], value[:index]...)
+	fields := d.fields[:0]
+	for _, v := range value[index:] {
+		if field, ok := v.(zap.Field); ok {
+			fields = append(fields, field)
+		} else {
+			values = append(values, v)
+		}
+	}
+	d.values, d.fields = values, fields
+	return values, fields
+}
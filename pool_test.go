@@ -0,0 +1,31 @@
+package caolog_test
+
+import (
+	"context"
+	caolog "github.com/CaoStudio/caolog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"strings"
+	"testing"
+)
+
+// core 持有的 Entry 在之后的日志调用中不能被改写
+func TestRetainedEntry(t *testing.T) {
+	defer caolog.SetLevel(caolog.GetLevel())
+	caolog.SetLevel(caolog.DebugLevel)
+	for _, enableCaller := range []bool{true, false} {
+		caolog.EnableCaller(enableCaller)
+		core, logs := observer.New(zapcore.DebugLevel)
+		logger := &caolog.Logger{Logger: zap.New(core)}
+
+		logger.CInfo(context.Background(), 2, "first-message")
+		logger.CInfo(context.Background(), 2, "SECOND")
+		entries := logs.AllUntimed()
+		if len(entries) != 2 || !strings.HasSuffix(strings.TrimSpace(entries[0].Message), "first-message") ||
+			!strings.HasSuffix(strings.TrimSpace(entries[1].Message), "SECOND") {
+			t.Fatalf("caller %v: retained entries were overwritten: %+v", enableCaller, entries)
+		}
+	}
+	caolog.EnableCaller(true)
+}
@@ -0,0 +1,228 @@
+package caolog
+
+import (
+	"context"
+	"github.com/CaoStudio/caolog/internal/goroutine"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// flightRecorderKeys 最多同时保存多少个 trace/goroutine 的环形缓冲，超过后淘汰最早创建的
+const flightRecorderKeys = 1024
+
+var flightRecorder atomic.Pointer[recorder]
+
+type (
+	// recorder 保存被级别过滤掉的日志：一个全局缓冲，以及按 trace 或 goroutine 区分的缓冲
+	recorder struct {
+		mu     sync.Mutex
+		size   int
+		global *ring
+		rings  map[string]*ring
+		keys   []string
+		next   int
+		// seq 为每条记录编号，用于在全局缓冲与按 key 的缓冲之间去重
+		seq uint64
+	}
+
+	ring struct {
+		details []Details
+		size    int
+		next    int
+	}
+)
+
+// EnableFlightRecorder 开启飞行记录：低于级别的日志不再直接丢弃，而是保存在容量为 size 的环形缓冲中，
+// 在输出 error 及以上级别的日志、plugin.Recovery 捕获 panic 或收到信号时输出；size <= 0 时关闭。
+// 记录按 ctx 中的 traceID 分组，没有 trace 时按 goroutine 分组，获取 goroutine 编号需要调用一次
+// runtime.Stack，开启后每条被级别过滤且没有 trace 的日志都有这部分开销
+func EnableFlightRecorder(size int) {
+	if size <= 0 {
+		flightRecorder.Store(nil)
+		return
+	}
+	flightRecorder.Store(&recorder{
+		size:   size,
+		global: newRing(size),
+		rings:  make(map[string]*ring),
+		keys:   make([]string, flightRecorderKeys),
+	})
+}
+
+// DumpFlightRecorder 使用 ctx 中的 logger 输出 ctx 所属 trace 或当前 goroutine 的飞行记录
+func DumpFlightRecorder(ctx context.Context) {
+	FromContext(ctx).dumpFlightRecorder(ctx)
+}
+
+// DumpFlightRecorderOnSignal 收到 sigs 中的信号时输出全局飞行记录，调用返回的 stop 停止监听
+func DumpFlightRecorderOnSignal(sigs ...os.Signal) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+	go func() {
+		for {
+			select {
+			case sig := <-ch:
+				if r := flightRecorder.Load(); r != nil {
+					logger.dump(context.Background(), r.take(""), "signal "+sig.String())
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// record 将被级别过滤的日志保存到飞行记录中，Options 在输出时才执行
+func (l *Logger) record(c context.Context, deep int, level zapcore.Level, args ...interface{}) {
+	r := flightRecorder.Load()
+	// core 不接受的级别在输出飞行记录时同样会被丢弃，无需保存
+	if r == nil || !l.sinkEnabled(level) {
+		return
+	}
+	detail := l.makeDetails(deep, level, args...)
+	defer putDetails(detail)
+	// 拷贝出不引用对象池的记录，也不持有调用方的参数，内容已经格式化到 Message 中
+	r.add(recorderKey(c), detail.detach())
+}
+
+// dumpFlightRecorder 输出并清空 ctx 对应的飞行记录
+func (l *Logger) dumpFlightRecorder(c context.Context) {
+	if r := flightRecorder.Load(); r != nil {
+		key := recorderKey(c)
+		l.dump(c, r.take(key), key)
+	}
+}
+
+// dump 以标记包围输出飞行记录，每条记录与普通日志一样先执行 Options，Scrubber 等同样生效
+func (l *Logger) dump(c context.Context, details []Details, source string) {
+	if len(details) == 0 {
+		return
+	}
+	l.Logger.Warn("[FlightRecorder] begin "+source, zap.Int("records", len(details)))
+	for i := range details {
+		detail := &details[i]
+		if !l.apply(c, detail) {
+			continue
+		}
+		detail.Fields = append(detail.Fields, zap.Time("recorded", detail.Time))
+		level := detail.Level
+		l.write(detail, func(msg string, fields ...zap.Field) {
+			l.sinkLogger().Log(level, msg, fields...)
+		})
+	}
+	l.Logger.Warn("[FlightRecorder] end " + source)
+}
+
+// recorderKey 优先使用 traceID，没有 trace 时使用 goroutine
+func recorderKey(c context.Context) string {
+	if c != nil {
+		if spanCtx := trace.SpanContextFromContext(c); spanCtx.HasTraceID() {
+			return "trace " + spanCtx.TraceID().String()
+		}
+	}
+	return "goroutine " + strconv.FormatUint(goroutine.ID(), 10)
+}
+
+func (r *recorder) add(key string, detail Details) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	detail.seq = r.seq
+	r.global.add(detail)
+	keyRing, ok := r.rings[key]
+	if !ok {
+		if old := r.keys[r.next]; old != "" {
+			delete(r.rings, old)
+		}
+		r.keys[r.next] = key
+		r.next = (r.next + 1) % len(r.keys)
+		keyRing = newRing(r.size)
+		r.rings[key] = keyRing
+	}
+	keyRing.add(detail)
+}
+
+// take 取出并清空 key 对应的缓冲，key 为空时取全局缓冲；
+// 同一条记录同时保存在全局缓冲与 key 的缓冲中，取出后从另一侧删除，避免重复输出
+func (r *recorder) take(key string) []Details {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if key == "" {
+		details := r.global.take()
+		for _, keyRing := range r.rings {
+			keyRing.remove(details)
+		}
+		return details
+	}
+	keyRing, ok := r.rings[key]
+	if !ok {
+		return nil
+	}
+	details := keyRing.take()
+	r.global.remove(details)
+	return details
+}
+
+// newRing 返回容量为 size 的缓冲，空间随记录增加，不预先分配
+func newRing(size int) *ring {
+	return &ring{size: size}
+}
+
+func (r *ring) add(detail Details) {
+	if len(r.details) < r.size {
+		r.details = append(r.details, detail)
+		return
+	}
+	r.details[r.next] = detail
+	r.next = (r.next + 1) % r.size
+}
+
+// ordered 按时间顺序返回缓冲中的日志
+func (r *ring) ordered() []Details {
+	details := make([]Details, 0, len(r.details))
+	details = append(details, r.details[r.next:]...)
+	return append(details, r.details[:r.next]...)
+}
+
+// take 按时间顺序返回缓冲中的日志并清空，释放占用的空间
+func (r *ring) take() []Details {
+	details := r.ordered()
+	r.details = nil
+	r.next = 0
+	return details
+}
+
+// remove 删除 taken 中的记录，taken 与缓冲都按 seq 递增
+func (r *ring) remove(taken []Details) {
+	if len(taken) == 0 || len(r.details) == 0 {
+		return
+	}
+	ordered := r.ordered()
+	kept := ordered[:0]
+	i := 0
+	for _, detail := range ordered {
+		for i < len(taken) && taken[i].seq < detail.seq {
+			i++
+		}
+		if i < len(taken) && taken[i].seq == detail.seq {
+			continue
+		}
+		kept = append(kept, detail)
+	}
+	r.details = kept
+	r.next = 0
+}
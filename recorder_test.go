@@ -0,0 +1,87 @@
+package caolog_test
+
+import (
+	"bytes"
+	"context"
+	caolog "github.com/CaoStudio/caolog"
+	"github.com/CaoStudio/caolog/internal/caologtest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlightRecorder(t *testing.T) {
+	defer caolog.SetLevel(caolog.GetLevel())
+	defer caolog.EnableFlightRecorder(0)
+	caolog.SetLevel(caolog.ErrorLevel)
+	caolog.EnableFlightRecorder(2)
+	buf := &bytes.Buffer{}
+	logger := caologtest.NewBufferLogger(buf)
+	ctx := context.Background()
+
+	logger.CDebug(ctx, 2, "step 1")
+	logger.CInfo(ctx, 2, "step 2")
+	logger.CInfo(ctx, 2, "step 3")
+	if buf.Len() != 0 {
+		t.Fatalf("records below the level must not be written, got %q", buf.String())
+	}
+
+	logger.CError(ctx, 2, "failed")
+	out := buf.String()
+	begin := strings.Index(out, "[FlightRecorder] begin")
+	step2 := strings.Index(out, "step 2")
+	step3 := strings.Index(out, "step 3")
+	end := strings.Index(out, "[FlightRecorder] end")
+	failed := strings.Index(out, "failed")
+	if strings.Contains(out, "step 1") || begin < 0 || !(begin < step2 && step2 < step3 && step3 < end && end < failed) {
+		t.Fatalf("unexpected dump %q", out)
+	}
+
+	buf.Reset()
+	logger.CError(ctx, 2, "failed again")
+	if strings.Contains(buf.String(), "FlightRecorder") {
+		t.Fatalf("records must be dumped once, got %q", buf.String())
+	}
+}
+
+// 按 key 输出过的记录不会在信号输出全局记录时重复，反之亦然
+func TestFlightRecorderSignal(t *testing.T) {
+	defer caolog.SetLevel(caolog.GetLevel())
+	defer caolog.EnableFlightRecorder(0)
+	caolog.SetLevel(caolog.ErrorLevel)
+	caolog.EnableFlightRecorder(4)
+	core, logs := observer.New(zapcore.DebugLevel)
+	global := caolog.GetLogger()
+	saved := *global
+	defer func() { *global = saved }()
+	*global = caolog.Logger{Logger: zap.New(core)}
+	stop := caolog.DumpFlightRecorderOnSignal(os.Interrupt)
+	defer stop()
+	ctx := context.Background()
+
+	global.CInfo(ctx, 2, "step a")
+	global.CError(ctx, 2, "failed")
+	global.CInfo(ctx, 2, "step b")
+	process, _ := os.FindProcess(os.Getpid())
+	if err := process.Signal(os.Interrupt); err != nil {
+		t.Skipf("cannot send interrupt: %v", err)
+	}
+	for i := 0; i < 100 && logs.FilterMessageSnippet("[FlightRecorder] end signal").Len() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	global.CError(ctx, 2, "failed again")
+
+	if n := logs.FilterMessageSnippet("step a").Len(); n != 1 {
+		t.Fatalf("step a should be dumped once, got %d", n)
+	}
+	if n := logs.FilterMessageSnippet("step b").Len(); n != 1 {
+		t.Fatalf("step b should be dumped once by the signal, got %d", n)
+	}
+	if n := logs.FilterMessageSnippet("[FlightRecorder] begin").Len(); n != 2 {
+		t.Fatalf("expected one dump per source, got %d", n)
+	}
+}
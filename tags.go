@@ -0,0 +1,342 @@
+package caolog
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/bytedance/sonic"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// 结构体字段的 log 标签：
+//
+//	log:"-"            不输出该字段
+//	log:"mask"         非零值输出为 ******
+//	log:"hash"         输出以 SetHashKey 设置的密钥计算的 HMAC-SHA256 的前 16 位，可用于关联而不暴露原值
+//	log:"truncate=64"  文本超过 64 字节时截断
+//
+// 只有类型本身或嵌套的结构体、切片、map 元素中带有 log 标签时才会按标签编码，
+// 其余类型仍然使用 sonic；含有 interface 的类型（如 map[string]interface{}）按实际值逐个判断
+const (
+	tagSkip     = "-"
+	tagMask     = "mask"
+	tagHash     = "hash"
+	tagTruncate = "truncate="
+	maskedValue = "******"
+)
+
+type (
+	// typeInfo 每个类型的反射信息，按类型缓存
+	typeInfo struct {
+		// redact 为 true 时类型本身或其元素带有 log 标签
+		redact bool
+		// dynamic 为 true 时类型本身或其元素含有 interface，是否带有标签取决于实际值
+		dynamic bool
+		fields  []fieldInfo
+	}
+
+	fieldInfo struct {
+		index int
+		// 带引号的 JSON key，与 json 标签一致
+		key       string
+		omitEmpty bool
+		// 匿名结构体字段，字段展开到外层
+		inline bool
+		tag    string
+		limit  int
+	}
+)
+
+var (
+	typeInfos cowMap[reflect.Type, *typeInfo]
+	// hashKey log:"hash" 使用的 HMAC 密钥，默认在启动时随机生成
+	hashKey atomic.Pointer[[]byte]
+
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+)
+
+func init() {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	hashKey.Store(&key)
+}
+
+// SetHashKey 设置 log:"hash" 使用的 HMAC 密钥。默认密钥在进程启动时随机生成，
+// 同一个值的摘要只在本进程内一致；多个实例之间需要关联时设置相同的密钥，并像其他凭据一样保密。
+// 手机号、身份证号等取值范围小的内容，拿到密钥即可穷举还原，hash 只是假名化而不是脱敏。
+// 返回之前的密钥，用于恢复
+func SetHashKey(key []byte) (previous []byte) {
+	key = append([]byte(nil), key...)
+	return *hashKey.Swap(&key)
+}
+
+// redacted 在 zap 的 JSON 字段中按 log 标签编码
+type redacted struct {
+	value interface{}
+}
+
+func (r redacted) MarshalJSON() ([]byte, error) {
+	return appendRedacted(nil, reflect.ValueOf(r.value)), nil
+}
+
+// needsRedact 判断值是否需要按 log 标签编码；含有 interface 的类型只有实际值中带有标签时才需要，
+// 否则仍然只调用一次 sonic；实现了 json.Marshaler 且没有标签的类型仍然由自身编码
+func needsRedact(rv reflect.Value) bool {
+	if kind := rv.Kind(); kind <= reflect.Complex128 || kind == reflect.String {
+		return false
+	}
+	info := typeInfoOf(rv.Type())
+	if info.redact {
+		return true
+	}
+	return info.dynamic && !rv.Type().Implements(jsonMarshalerType) && hasTagged(rv)
+}
+
+// hasTagged 沿可能含有 interface 的路径检查实际值中是否有带标签的类型
+func hasTagged(rv reflect.Value) bool {
+	// 最常见的两种形式直接遍历，不经过 reflect 读取元素
+	if rv.CanInterface() {
+		switch v := rv.Interface().(type) {
+		case map[string]interface{}:
+			for _, elem := range v {
+				if needsRedact(reflect.ValueOf(elem)) {
+					return true
+				}
+			}
+			return false
+		case []interface{}:
+			for _, elem := range v {
+				if needsRedact(reflect.ValueOf(elem)) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return !rv.IsNil() && needsRedact(rv.Elem())
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if needsRedact(rv.Index(i)) {
+				return true
+			}
+		}
+	case reflect.Map:
+		// 复用同一个 Value 读取元素，避免每个元素复制一次
+		var iter reflect.MapIter
+		iter.Reset(rv)
+		elem := reflect.New(rv.Type().Elem()).Elem()
+		for iter.Next() {
+			elem.SetIterValue(&iter)
+			if needsRedact(elem) {
+				return true
+			}
+		}
+	case reflect.Struct:
+		for _, fi := range typeInfoOf(rv.Type()).fields {
+			if needsRedact(rv.Field(fi.index)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func typeInfoOf(t reflect.Type) *typeInfo {
+	if info, ok := typeInfos.load(t); ok {
+		return info
+	}
+	info := buildTypeInfo(t, map[reflect.Type]*typeInfo{})
+	typeInfos.store(t, info)
+	return info
+}
+
+// buildTypeInfo 解析类型的字段，visiting 用于处理递归类型
+func buildTypeInfo(t reflect.Type, visiting map[reflect.Type]*typeInfo) *typeInfo {
+	if info, ok := typeInfos.load(t); ok {
+		return info
+	}
+	if info, ok := visiting[t]; ok {
+		return info
+	}
+	info := &typeInfo{}
+	visiting[t] = info
+
+	switch t.Kind() {
+	case reflect.Interface:
+		info.dynamic = true
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		elem := buildTypeInfo(t.Elem(), visiting)
+		info.redact, info.dynamic = elem.redact, elem.dynamic
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() && !field.Anonymous {
+				continue
+			}
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" && opts == "" {
+				continue
+			}
+			fi := fieldInfo{
+				index:     i,
+				omitEmpty: strings.Contains(opts, "omitempty"),
+				tag:       field.Tag.Get("log"),
+			}
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+				fi.inline = true
+			} else if !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			fi.key = strconv.Quote(name) + ":"
+			if n, ok := strings.CutPrefix(fi.tag, tagTruncate); ok {
+				fi.tag = tagTruncate
+				fi.limit, _ = strconv.Atoi(n)
+			}
+			elem := buildTypeInfo(field.Type, visiting)
+			if fi.tag != "" || elem.redact {
+				info.redact = true
+			}
+			if elem.dynamic {
+				info.dynamic = true
+			}
+			info.fields = append(info.fields, fi)
+		}
+	}
+	return info
+}
+
+// appendRedacted 按 log 标签将 rv 编码为 JSON
+func appendRedacted(buf []byte, rv reflect.Value) []byte {
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return append(buf, "null"...)
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return append(buf, "null"...)
+		}
+		return appendRedacted(buf, rv.Elem())
+	case reflect.Struct:
+		if !needsRedact(rv) {
+			break
+		}
+		buf = append(buf, '{')
+		buf, _ = appendStructFields(buf, rv, false)
+		return append(buf, '}')
+	case reflect.Slice, reflect.Array:
+		if !needsRedact(rv) || (rv.Kind() == reflect.Slice && rv.IsNil()) {
+			break
+		}
+		buf = append(buf, '[')
+		for i := 0; i < rv.Len(); i++ {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendRedacted(buf, rv.Index(i))
+		}
+		return append(buf, ']')
+	case reflect.Map:
+		if !needsRedact(rv) || rv.IsNil() {
+			break
+		}
+		buf = append(buf, '{')
+		iter := rv.MapRange()
+		for i := 0; iter.Next(); i++ {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendJSON(buf, string(appendValue(nil, iter.Key().Interface())))
+			buf = append(buf, ':')
+			buf = appendRedacted(buf, iter.Value())
+		}
+		return append(buf, '}')
+	}
+	return appendJSON(buf, rv.Interface())
+}
+
+// appendStructFields 追加结构体的字段，返回是否写入了字段，用于展开匿名字段时添加逗号
+func appendStructFields(buf []byte, rv reflect.Value, written bool) ([]byte, bool) {
+	for _, fi := range typeInfoOf(rv.Type()).fields {
+		field := rv.Field(fi.index)
+		if fi.tag == tagSkip || (fi.omitEmpty && field.IsZero()) {
+			continue
+		}
+		if fi.inline {
+			if field.Kind() == reflect.Pointer {
+				if field.IsNil() {
+					continue
+				}
+				field = field.Elem()
+			}
+			buf, written = appendStructFields(buf, field, written)
+			continue
+		}
+		if written {
+			buf = append(buf, ',')
+		}
+		written = true
+		buf = append(buf, fi.key...)
+		buf = appendTagged(buf, fi, field)
+	}
+	return buf, written
+}
+
+// appendTagged 按字段的 log 标签追加字段值
+func appendTagged(buf []byte, fi fieldInfo, field reflect.Value) []byte {
+	switch fi.tag {
+	case tagMask:
+		if field.IsZero() {
+			return appendRedacted(buf, field)
+		}
+		return appendJSON(buf, maskedValue)
+	case tagHash:
+		mac := hmac.New(sha256.New, *hashKey.Load())
+		mac.Write(fieldText(field))
+		return appendJSON(buf, "hmac:"+hex.EncodeToString(mac.Sum(nil)[:8]))
+	case tagTruncate:
+		return appendJSON(buf, truncateText(fieldText(field), fi.limit))
+	default:
+		return appendRedacted(buf, field)
+	}
+}
+
+// fieldText 字段值的文本，与日志内容中的格式相同
+func fieldText(field reflect.Value) []byte {
+	if field.Kind() == reflect.Pointer && field.IsNil() {
+		return nil
+	}
+	return appendValue(nil, field.Interface())
+}
+
+// truncateText 截断到 limit 字节以内，不拆开多字节字符
+func truncateText(text []byte, limit int) string {
+	if limit < 0 || len(text) <= limit {
+		return string(text)
+	}
+	for limit > 0 && !utf8.RuneStart(text[limit]) {
+		limit--
+	}
+	return string(text[:limit]) + "..."
+}
+
+func appendJSON(buf []byte, v interface{}) []byte {
+	data, err := sonic.Marshal(v)
+	if err != nil {
+		return appendFormatError(buf, err)
+	}
+	return append(buf, data...)
+}
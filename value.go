@@ -0,0 +1,221 @@
+package caolog
+
+import (
+	"encoding"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const nilValue = "<nil>"
+
+type (
+	// LogStringer 由类型自己决定在日志中的文本，优先于 error 与 fmt.Stringer，
+	// 用于只输出摘要或隐藏敏感字段
+	LogStringer interface {
+		LogString() string
+	}
+
+	// ObjectMarshaler 与 zap 的 ObjectMarshaler 相同，控制台输出时编码为 JSON 对象，
+	// JSON 输出的字段中按对象展开
+	ObjectMarshaler = zapcore.ObjectMarshaler
+)
+
+var (
+	// objectEncoder 将 ObjectMarshaler 编码为 JSON 文本，只输出对象本身的字段
+	objectEncoder = zapcore.NewJSONEncoder(zapcore.EncoderConfig{
+		EncodeDuration: zapcore.StringDurationEncoder,
+		EncodeTime:     zapcore.RFC3339NanoTimeEncoder,
+		SkipLineEnding: true,
+	})
+	// timeLayout 格式化 time.Time 参数使用的格式
+	timeLayout atomic.Pointer[string]
+	// formatters 按具体类型注册的格式化函数
+	formatters cowMap[reflect.Type, func(buf []byte, v interface{}) []byte]
+)
+
+func init() {
+	SetTimeLayout(time.RFC3339Nano)
+}
+
+// SetTimeLayout 设置 time.Time 参数的输出格式，默认 time.RFC3339Nano
+func SetTimeLayout(layout string) {
+	timeLayout.Store(&layout)
+}
+
+// RegisterFormatter 为类型 T 注册格式化函数，将 v 的文本追加到 buf 并返回，优先于内置的格式化；
+// T 需要是具体类型，注册接口类型不会生效
+func RegisterFormatter[T any](formatter func(buf []byte, v T) []byte) {
+	formatters.store(reflect.TypeFor[T](), func(buf []byte, v interface{}) []byte {
+		return formatter(buf, v.(T))
+	})
+}
+
+// appendValues 追加每个值的文本，每个值之后追加一个 tab
+func appendValues(buf []byte, value []interface{}) []byte {
+	for _, v := range value {
+		buf = appendValue(buf, v)
+		buf = append(buf, tabByte)
+	}
+	return buf
+}
+
+// appendValue 追加单个值的文本，基础类型不产生内存分配
+func appendValue(buf []byte, v interface{}) []byte {
+	if v == nil {
+		return append(buf, nilValue...)
+	}
+	if !formatters.empty() {
+		if formatter, ok := formatters.load(reflect.TypeOf(v)); ok {
+			return formatter(buf, v)
+		}
+	}
+	switch v := v.(type) {
+	case float64:
+		return strconv.AppendFloat(buf, v, 'f', -1, 64)
+	case float32:
+		return strconv.AppendFloat(buf, float64(v), 'f', -1, 64)
+	case int:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case uint:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case int8:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case uint8:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case int16:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case uint16:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case int32:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case uint32:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case int64:
+		return strconv.AppendInt(buf, v, 10)
+	case uint64:
+		return strconv.AppendUint(buf, v, 10)
+	case bool:
+		return strconv.AppendBool(buf, v)
+	case string:
+		return append(buf, v...)
+	case []byte:
+		return append(buf, v...)
+	case []int:
+		return appendInts(buf, v)
+	case []int32:
+		return appendInts(buf, v)
+	case []int64:
+		return appendInts(buf, v)
+	case []uint:
+		return appendUints(buf, v)
+	case []uint32:
+		return appendUints(buf, v)
+	case []uint64:
+		return appendUints(buf, v)
+	case time.Duration:
+		return append(buf, v.String()...)
+	case time.Time:
+		return v.AppendFormat(buf, *timeLayout.Load())
+	case Lazy:
+		if v == nil {
+			return append(buf, nilValue...)
+		}
+		return appendValue(buf, v())
+	}
+
+	// 以下类型的方法可能不接受 nil 指针
+	if isNilPointer(v) {
+		return append(buf, nilValue...)
+	}
+	switch v := v.(type) {
+	case LogStringer:
+		return append(buf, v.LogString()...)
+	case ObjectMarshaler:
+		return appendObject(buf, v)
+	case error:
+		return append(buf, v.Error()...)
+	case fmt.Stringer:
+		return append(buf, v.String()...)
+	case encoding.TextMarshaler:
+		text, err := v.MarshalText()
+		if err != nil {
+			return appendFormatError(buf, err)
+		}
+		return append(buf, text...)
+	default:
+		// 带有 log 标签的类型按标签编码，避免输出密码等字段
+		if rv := reflect.ValueOf(v); needsRedact(rv) {
+			return appendRedacted(buf, rv)
+		}
+		return appendJSON(buf, v)
+	}
+}
+
+// appendInts 以 JSON 数组的形式追加整数切片，与 sonic 的输出相同，nil 输出为 null
+func appendInts[T int | int32 | int64](buf []byte, v []T) []byte {
+	if v == nil {
+		return append(buf, "null"...)
+	}
+	buf = append(buf, '[')
+	for i, n := range v {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendInt(buf, int64(n), 10)
+	}
+	return append(buf, ']')
+}
+
+// appendUints 与 appendInts 相同，用于无符号整数切片
+func appendUints[T uint | uint32 | uint64](buf []byte, v []T) []byte {
+	if v == nil {
+		return append(buf, "null"...)
+	}
+	buf = append(buf, '[')
+	for i, n := range v {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendUint(buf, uint64(n), 10)
+	}
+	return append(buf, ']')
+}
+
+// appendObject 以 JSON 对象的形式追加 ObjectMarshaler
+func appendObject(buf []byte, v ObjectMarshaler) []byte {
+	object, err := objectEncoder.EncodeEntry(zapcore.Entry{}, []zapcore.Field{zap.Inline(v)})
+	if err != nil {
+		return appendFormatError(buf, err)
+	}
+	buf = append(buf, object.Bytes()...)
+	object.Free()
+	return buf
+}
+
+// Any 与 zap.Any 相同，但 LogStringer 输出为 LogString 的结果，带有 log 标签的结构体按标签编码，
+// 用于 key、value 形式的参数
+func Any(key string, value interface{}) zap.Field {
+	if v, ok := value.(LogStringer); ok && !isNilPointer(value) {
+		return zap.String(key, v.LogString())
+	}
+	if needsRedact(reflect.ValueOf(value)) {
+		return zap.Reflect(key, redacted{value})
+	}
+	return zap.Any(key, value)
+}
+
+func appendFormatError(buf []byte, err error) []byte {
+	buf = append(buf, "Log Format Error:"...)
+	return append(buf, err.Error()...)
+}
+
+// isNilPointer 判断 v 是否为有类型的 nil 指针
+func isNilPointer(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
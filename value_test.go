@@ -0,0 +1,156 @@
+package caolog_test
+
+import (
+	"errors"
+	caolog "github.com/CaoStudio/caolog"
+	"go.uber.org/zap/zapcore"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type point struct{ X, Y int }
+
+type account struct {
+	ID       int
+	Password string
+}
+
+func (a account) LogString() string {
+	return "account " + strconv.Itoa(a.ID)
+}
+
+type order struct {
+	ID    string
+	Items []string
+}
+
+func (o *order) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("id", o.ID)
+	enc.AddInt("items", len(o.Items))
+	return nil
+}
+
+func TestFormatValues(t *testing.T) {
+	var nilErr *net.OpError
+	var nilIP *net.IP
+	ts := time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)
+	caolog.RegisterFormatter(func(buf []byte, p point) []byte {
+		buf = strconv.AppendInt(buf, int64(p.X), 10)
+		buf = append(buf, ',')
+		return strconv.AppendInt(buf, int64(p.Y), 10)
+	})
+
+	cases := []struct {
+		value interface{}
+		want  string
+	}{
+		{nil, "<nil>"},
+		{true, "true"},
+		{1500 * time.Millisecond, "1.5s"},
+		{ts, "2024-05-01T08:30:00Z"},
+		{errors.New("boom"), "boom"},
+		{nilErr, "<nil>"},
+		{nilIP, "<nil>"},
+		{net.IPv4(127, 0, 0, 1), "127.0.0.1"},
+		{point{1, 2}, "1,2"},
+		{map[string]int{"a": 1}, `{"a":1}`},
+		{account{ID: 7, Password: "secret"}, "account 7"},
+		{&order{ID: "o1", Items: []string{"a", "b"}}, `{"id":"o1","items":2}`},
+		{(*order)(nil), "<nil>"},
+	}
+	for _, c := range cases {
+		if got := caolog.FormatBufferPool(c.value); got != c.want+"\t" {
+			t.Errorf("format %T: got %q, want %q", c.value, got, c.want)
+		}
+	}
+}
+
+func TestAnyLogString(t *testing.T) {
+	field := caolog.Any("account", account{ID: 7, Password: "secret"})
+	if field.Type != zapcore.StringType || field.String != "account 7" {
+		t.Fatalf("Any should use LogString, got %+v", field)
+	}
+}
+
+type credentials struct {
+	User     string `json:"user"`
+	Password string `json:"password" log:"-"`
+	Token    string `log:"mask"`
+	Email    string `json:"email" log:"hash"`
+	Note     string `json:"note,omitempty" log:"truncate=5"`
+}
+
+type login struct {
+	credentials
+	Sessions []*credentials `json:"sessions"`
+	Attempts int            `json:"attempts"`
+}
+
+func TestFormatTaggedStruct(t *testing.T) {
+	c := &credentials{User: "cao", Password: "p@ss", Token: "abc", Email: "cao@example.com", Note: "你好世界"}
+	got := caolog.FormatBufferPool(login{credentials: *c, Sessions: []*credentials{c, nil}, Attempts: 2})
+	for _, leaked := range []string{"p@ss", "abc", "cao@example.com", "世界"} {
+		if strings.Contains(got, leaked) {
+			t.Fatalf("%q should be redacted, got %s", leaked, got)
+		}
+	}
+	want := `{"user":"cao","Token":"******","email":"hmac:`
+	if !strings.HasPrefix(got, want) || !strings.Contains(got, `"note":"你...","sessions":[{`) ||
+		!strings.HasSuffix(got, `,null],"attempts":2}`+"\t") {
+		t.Fatalf("unexpected tagged output %s", got)
+	}
+}
+
+func TestFormatIntSlices(t *testing.T) {
+	got := caolog.FormatBufferPool[interface{}]([]int32{1, -2}, []uint64{3}, []int(nil))
+	if got != "[1,-2]\t[3]\tnull\t" {
+		t.Fatalf("unexpected int slices %q", got)
+	}
+}
+
+func TestFormatTaggedInInterface(t *testing.T) {
+	cred := credentials{User: "cao", Password: "p@ss"}
+	for _, v := range []interface{}{
+		map[string]interface{}{"login": cred, "n": 1},
+		[]interface{}{"a", &cred},
+		struct{ Payload interface{} }{cred},
+	} {
+		got := caolog.FormatBufferPool(v)
+		if strings.Contains(got, "p@ss") || !strings.Contains(got, `"user":"cao"`) {
+			t.Fatalf("tagged values inside interfaces should be redacted, got %s", got)
+		}
+	}
+	if got := caolog.FormatBufferPool([]interface{}{"a", 1}); got != `["a",1]`+"\t" {
+		t.Fatalf("untagged values should be unchanged, got %s", got)
+	}
+
+	enc := zapcore.NewJSONEncoder(zapcore.EncoderConfig{})
+	buf, err := enc.EncodeEntry(zapcore.Entry{}, []zapcore.Field{caolog.Any("login", map[string]interface{}{"cred": cred})})
+	if err != nil || strings.Contains(buf.String(), "p@ss") {
+		t.Fatalf("Any should honor log tags inside interfaces, got %s %v", buf, err)
+	}
+}
+
+func TestHashKey(t *testing.T) {
+	previous := caolog.SetHashKey([]byte("k1"))
+	defer caolog.SetHashKey(previous)
+	first := caolog.FormatBufferPool(credentials{Email: "cao@example.com"})
+	if again := caolog.FormatBufferPool(credentials{Email: "cao@example.com"}); again != first {
+		t.Fatalf("the same key should give the same hash, got %s and %s", first, again)
+	}
+	caolog.SetHashKey([]byte("k2"))
+	if other := caolog.FormatBufferPool(credentials{Email: "cao@example.com"}); other == first {
+		t.Fatalf("hashes should depend on the key, got %s", other)
+	}
+}
+
+func TestAnyTaggedStruct(t *testing.T) {
+	enc := zapcore.NewJSONEncoder(zapcore.EncoderConfig{})
+	buf, err := enc.EncodeEntry(zapcore.Entry{}, []zapcore.Field{caolog.Any("login", credentials{Password: "p@ss"})})
+	if err != nil || strings.Contains(buf.String(), "p@ss") {
+		t.Fatalf("Any should honor log tags, got %s %v", buf, err)
+	}
+}